@@ -0,0 +1,44 @@
+package apk
+
+import (
+	"archive/zip"
+	"sort"
+	"strings"
+)
+
+const nativeLibDir = "lib/"
+
+// NativeABIs returns the ABIs the APK contains native libraries for, like: arm64-v8a, x86_64.
+// The native libraries are stored as lib/<abi>/<name>.so entries.
+func NativeABIs(apkPth string) ([]string, error) {
+	r, err := zip.OpenReader(apkPth)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	return nativeABIs(&r.Reader), nil
+}
+
+func nativeABIs(r *zip.Reader) []string {
+	found := map[string]bool{}
+	for _, f := range r.File {
+		if !strings.HasPrefix(f.Name, nativeLibDir) || !strings.HasSuffix(f.Name, ".so") {
+			continue
+		}
+		components := strings.Split(strings.TrimPrefix(f.Name, nativeLibDir), "/")
+		if len(components) != 2 || components[0] == "" {
+			continue
+		}
+		found[components[0]] = true
+	}
+
+	abis := make([]string, 0, len(found))
+	for abi := range found {
+		abis = append(abis, abi)
+	}
+	sort.Strings(abis)
+	return abis
+}
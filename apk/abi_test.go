@@ -0,0 +1,32 @@
+package apk
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_NativeABIs(t *testing.T) {
+	pth := writeTestAPK(t, map[string][]byte{
+		"lib/x86_64/libnative.so":      nil,
+		"lib/x86_64/libother.so":       nil,
+		"lib/arm64-v8a/libnative.so":   nil,
+		"lib/armeabi-v7a/libnative.so": nil,
+		"lib/README.txt":               nil,
+		"assets/lib/x86/libfake.so":    nil,
+		"classes.dex":                  nil,
+	})
+
+	got, err := NativeABIs(pth)
+	if err != nil {
+		t.Fatalf("NativeABIs() error = %v", err)
+	}
+	want := []string{"arm64-v8a", "armeabi-v7a", "x86_64"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NativeABIs() = %v, want %v", got, want)
+	}
+
+	noNative := writeTestAPK(t, map[string][]byte{"classes.dex": nil})
+	if got, err := NativeABIs(noNative); err != nil || len(got) != 0 {
+		t.Errorf("NativeABIs() = %v, %v, want no ABIs", got, err)
+	}
+}
@@ -0,0 +1,350 @@
+package apk
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf16"
+)
+
+// Chunk types of the Android binary XML (AXML) format,
+// see: frameworks/base/libs/androidfw/include/androidfw/ResourceTypes.h
+const (
+	chunkStringPool        = 0x0001
+	chunkXML               = 0x0003
+	chunkXMLStartNamespace = 0x0100
+	chunkXMLEndNamespace   = 0x0101
+	chunkXMLStartElement   = 0x0102
+	chunkXMLEndElement     = 0x0103
+	chunkXMLResourceMap    = 0x0180
+
+	chunkHeaderSize      = 8
+	stringPoolHeaderSize = 28
+	xmlNodeHeaderSize    = 16
+	xmlAttrExtSize       = 20
+	xmlAttrSize          = 20
+
+	stringPoolUTF8Flag = 1 << 8
+	noIndex            = 0xffffffff
+)
+
+// Typed value data types
+const (
+	typeNull      = 0x00
+	typeReference = 0x01
+	typeAttribute = 0x02
+	typeString    = 0x03
+	typeFloat     = 0x04
+	typeIntDec    = 0x10
+	typeIntHex    = 0x11
+	typeIntBool   = 0x12
+)
+
+// Attribute names by resource ID, used when the name is stripped from the string pool (for example, by obfuscators).
+var attributeNamesByResourceID = map[uint32]string{
+	0x01010001: "label",
+	0x01010003: "name",
+	0x01010021: "targetPackage",
+	0x0101020c: "minSdkVersion",
+	0x0101021b: "versionCode",
+	0x0101021c: "versionName",
+	0x01010270: "targetSdkVersion",
+	0x01010271: "maxSdkVersion",
+	0x01010572: "compileSdkVersion",
+}
+
+var le = binary.LittleEndian
+
+// Attr is an attribute of a decoded binary XML element.
+type Attr struct {
+	Namespace  string
+	Name       string
+	ResourceID uint32
+	Value      string
+}
+
+// Element is a decoded binary XML element.
+type Element struct {
+	Name     string
+	Attrs    []Attr
+	Children []*Element
+}
+
+// Attr returns the value of the attribute with the given name, regardless of its namespace.
+func (e *Element) Attr(name string) (string, bool) {
+	for _, attr := range e.Attrs {
+		if attr.Name == name {
+			return attr.Value, true
+		}
+	}
+	return "", false
+}
+
+// ChildrenByName returns the direct children with the given name.
+func (e *Element) ChildrenByName(name string) []*Element {
+	var children []*Element
+	for _, child := range e.Children {
+		if child.Name == name {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// ParseXML decodes an Android binary XML document, like the AndroidManifest.xml of an APK,
+// and returns its root element.
+func ParseXML(data []byte) (*Element, error) {
+	typ, headerSize, size, err := chunkHeader(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if typ != chunkXML {
+		return nil, fmt.Errorf("not a binary XML document, chunk type: 0x%04x", typ)
+	}
+
+	var pool []string
+	var resourceIDs []uint32
+	var root *Element
+	var stack []*Element
+
+	for offset := headerSize; offset < size; {
+		typ, _, chunkSize, err := chunkHeader(data[:size], offset)
+		if err != nil {
+			return nil, err
+		}
+		chunk := data[offset : offset+chunkSize]
+
+		switch typ {
+		case chunkStringPool:
+			if pool, err = parseStringPool(chunk); err != nil {
+				return nil, err
+			}
+		case chunkXMLResourceMap:
+			resourceIDs = parseResourceMap(chunk)
+		case chunkXMLStartElement:
+			element, err := parseStartElement(chunk, pool, resourceIDs)
+			if err != nil {
+				return nil, err
+			}
+			if len(stack) == 0 {
+				if root != nil {
+					return nil, fmt.Errorf("multiple root elements")
+				}
+				root = element
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, element)
+			}
+			stack = append(stack, element)
+		case chunkXMLEndElement:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("unexpected end element at offset: %d", offset)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			// Namespace, CDATA and unknown chunks are not needed to read the element tree.
+		}
+
+		offset += chunkSize
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("no root element found")
+	}
+	return root, nil
+}
+
+func chunkHeader(data []byte, offset int) (typ uint16, headerSize int, size int, err error) {
+	if offset < 0 || offset+chunkHeaderSize > len(data) {
+		return 0, 0, 0, fmt.Errorf("truncated chunk header at offset: %d", offset)
+	}
+	typ = le.Uint16(data[offset:])
+	headerSize = int(le.Uint16(data[offset+2:]))
+	size = int(le.Uint32(data[offset+4:]))
+	if headerSize < chunkHeaderSize || size < headerSize || offset+size > len(data) {
+		return 0, 0, 0, fmt.Errorf("invalid chunk (type: 0x%04x, header size: %d, size: %d) at offset: %d", typ, headerSize, size, offset)
+	}
+	return typ, headerSize, size, nil
+}
+
+func parseStringPool(chunk []byte) ([]string, error) {
+	if len(chunk) < stringPoolHeaderSize {
+		return nil, fmt.Errorf("truncated string pool header")
+	}
+	headerSize := int(le.Uint16(chunk[2:]))
+	count := int(le.Uint32(chunk[8:]))
+	flags := le.Uint32(chunk[16:])
+	stringsStart := int(le.Uint32(chunk[20:]))
+
+	if headerSize+count*4 > len(chunk) {
+		return nil, fmt.Errorf("string pool offsets out of bounds")
+	}
+
+	pool := make([]string, count)
+	for i := 0; i < count; i++ {
+		pos := stringsStart + int(le.Uint32(chunk[headerSize+i*4:]))
+		var s string
+		var err error
+		if flags&stringPoolUTF8Flag != 0 {
+			s, err = decodeUTF8String(chunk, pos)
+		} else {
+			s, err = decodeUTF16String(chunk, pos)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode string #%d: %v", i, err)
+		}
+		pool[i] = s
+	}
+	return pool, nil
+}
+
+func decodeUTF8String(chunk []byte, pos int) (string, error) {
+	// The UTF-16 length is followed by the UTF-8 length, both are stored on 1 or 2 bytes.
+	_, pos, err := decodeUTF8Length(chunk, pos)
+	if err != nil {
+		return "", err
+	}
+	length, pos, err := decodeUTF8Length(chunk, pos)
+	if err != nil {
+		return "", err
+	}
+	if pos+length > len(chunk) {
+		return "", fmt.Errorf("string out of bounds")
+	}
+	return string(chunk[pos : pos+length]), nil
+}
+
+func decodeUTF8Length(chunk []byte, pos int) (int, int, error) {
+	if pos < 0 || pos >= len(chunk) {
+		return 0, 0, fmt.Errorf("string length out of bounds")
+	}
+	length := int(chunk[pos])
+	if length&0x80 == 0 {
+		return length, pos + 1, nil
+	}
+	if pos+1 >= len(chunk) {
+		return 0, 0, fmt.Errorf("string length out of bounds")
+	}
+	return (length&0x7f)<<8 | int(chunk[pos+1]), pos + 2, nil
+}
+
+func decodeUTF16String(chunk []byte, pos int) (string, error) {
+	if pos < 0 || pos+2 > len(chunk) {
+		return "", fmt.Errorf("string length out of bounds")
+	}
+	length := int(le.Uint16(chunk[pos:]))
+	pos += 2
+	if length&0x8000 != 0 {
+		if pos+2 > len(chunk) {
+			return "", fmt.Errorf("string length out of bounds")
+		}
+		length = (length&0x7fff)<<16 | int(le.Uint16(chunk[pos:]))
+		pos += 2
+	}
+	if pos+length*2 > len(chunk) {
+		return "", fmt.Errorf("string out of bounds")
+	}
+
+	units := make([]uint16, length)
+	for i := range units {
+		units[i] = le.Uint16(chunk[pos+i*2:])
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+func parseResourceMap(chunk []byte) []uint32 {
+	headerSize := int(le.Uint16(chunk[2:]))
+	var ids []uint32
+	for pos := headerSize; pos+4 <= len(chunk); pos += 4 {
+		ids = append(ids, le.Uint32(chunk[pos:]))
+	}
+	return ids
+}
+
+func parseStartElement(chunk []byte, pool []string, resourceIDs []uint32) (*Element, error) {
+	headerSize := int(le.Uint16(chunk[2:]))
+	if headerSize < xmlNodeHeaderSize || headerSize+xmlAttrExtSize > len(chunk) {
+		return nil, fmt.Errorf("truncated start element")
+	}
+	ext := chunk[headerSize:]
+
+	name, err := poolString(pool, le.Uint32(ext[4:]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid element name: %v", err)
+	}
+	attrStart := int(le.Uint16(ext[8:]))
+	attrSize := int(le.Uint16(ext[10:]))
+	attrCount := int(le.Uint16(ext[12:]))
+	if attrCount > 0 && (attrSize < xmlAttrSize || attrStart+attrCount*attrSize > len(ext)) {
+		return nil, fmt.Errorf("attributes of %s out of bounds", name)
+	}
+
+	element := &Element{Name: name}
+	for i := 0; i < attrCount; i++ {
+		a := ext[attrStart+i*attrSize:]
+
+		namespace, err := poolString(pool, le.Uint32(a[0:]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid attribute namespace: %v", err)
+		}
+		nameIndex := le.Uint32(a[4:])
+		attrName, err := poolString(pool, nameIndex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid attribute name: %v", err)
+		}
+		var resourceID uint32
+		if int(nameIndex) < len(resourceIDs) {
+			resourceID = resourceIDs[nameIndex]
+			if attrName == "" {
+				attrName = attributeNamesByResourceID[resourceID]
+			}
+		}
+
+		value, err := attributeValue(pool, le.Uint32(a[8:]), a[15], le.Uint32(a[16:]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of attribute %s: %v", attrName, err)
+		}
+
+		element.Attrs = append(element.Attrs, Attr{Namespace: namespace, Name: attrName, ResourceID: resourceID, Value: value})
+	}
+	return element, nil
+}
+
+func poolString(pool []string, index uint32) (string, error) {
+	if index == noIndex {
+		return "", nil
+	}
+	if int(index) >= len(pool) {
+		return "", fmt.Errorf("string index %d out of bounds (%d)", index, len(pool))
+	}
+	return pool[index], nil
+}
+
+// attributeValue formats the typed value of an attribute the way aapt dump does.
+func attributeValue(pool []string, rawValue uint32, dataType byte, data uint32) (string, error) {
+	if rawValue != noIndex {
+		return poolString(pool, rawValue)
+	}
+
+	switch dataType {
+	case typeNull:
+		return "", nil
+	case typeString:
+		return poolString(pool, data)
+	case typeReference:
+		return fmt.Sprintf("@0x%08x", data), nil
+	case typeAttribute:
+		return fmt.Sprintf("?0x%08x", data), nil
+	case typeFloat:
+		return strconv.FormatFloat(float64(math.Float32frombits(data)), 'g', -1, 32), nil
+	case typeIntDec:
+		return strconv.Itoa(int(int32(data))), nil
+	case typeIntHex:
+		return fmt.Sprintf("0x%x", data), nil
+	case typeIntBool:
+		return strconv.FormatBool(data != 0), nil
+	default:
+		return fmt.Sprintf("0x%08x", data), nil
+	}
+}
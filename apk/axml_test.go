@@ -0,0 +1,256 @@
+package apk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+const androidNamespace = "http://schemas.android.com/apk/res/android"
+
+func Test_ParseXML(t *testing.T) {
+	manifest := testElement{
+		name: "manifest",
+		attrs: []testAttr{
+			{name: "versionCode", resourceID: 0x0101021b, dataType: typeIntDec, data: 42},
+			{name: "versionName", resourceID: 0x0101021c, value: "1.2.3"},
+			{name: "package", value: "com.example.app"},
+		},
+		children: []testElement{
+			{
+				name: "uses-sdk",
+				attrs: []testAttr{
+					{name: "minSdkVersion", resourceID: 0x0101020c, dataType: typeIntDec, data: 21},
+					{name: "targetSdkVersion", resourceID: 0x01010270, dataType: typeIntDec, data: 34},
+				},
+			},
+			{
+				name: "application",
+				attrs: []testAttr{
+					{name: "label", resourceID: 0x01010001, dataType: typeReference, data: 0x7f0e001b},
+					{name: "debuggable", resourceID: 0x0101000f, dataType: typeIntBool, data: 0xffffffff},
+				},
+			},
+		},
+	}
+
+	for _, utf8 := range []bool{false, true} {
+		root, err := ParseXML(encodeTestXML(manifest, utf8))
+		if err != nil {
+			t.Fatalf("ParseXML() (utf8: %v) error = %v", utf8, err)
+		}
+
+		if root.Name != "manifest" || len(root.Children) != 2 {
+			t.Fatalf("ParseXML() (utf8: %v) = %+v", utf8, root)
+		}
+
+		got := map[string]string{}
+		for _, element := range append([]*Element{root}, root.Children...) {
+			for _, attr := range element.Attrs {
+				got[element.Name+"/"+attr.Name] = attr.Value
+			}
+		}
+		want := map[string]string{
+			"manifest/versionCode":      "42",
+			"manifest/versionName":      "1.2.3",
+			"manifest/package":          "com.example.app",
+			"uses-sdk/minSdkVersion":    "21",
+			"uses-sdk/targetSdkVersion": "34",
+			"application/label":         "@0x7f0e001b",
+			"application/debuggable":    "true",
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseXML() (utf8: %v) attributes = %v, want %v", utf8, got, want)
+		}
+	}
+}
+
+func Test_ParseXML_strippedAttributeNames(t *testing.T) {
+	// Obfuscators strip the names of the framework attributes, these are identified by their resource ID
+	element := testElement{
+		name: "manifest",
+		attrs: []testAttr{
+			{name: "", resourceID: 0x0101021b, dataType: typeIntDec, data: 7},
+			{name: "package", value: "com.example.app"},
+		},
+	}
+
+	root, err := ParseXML(encodeTestXML(element, false))
+	if err != nil {
+		t.Fatalf("ParseXML() error = %v", err)
+	}
+	if got, ok := root.Attr("versionCode"); !ok || got != "7" {
+		t.Errorf("versionCode = %s, %v", got, ok)
+	}
+}
+
+func Test_ParseXML_invalid(t *testing.T) {
+	valid := encodeTestXML(testElement{name: "manifest", attrs: []testAttr{{name: "package", value: "com.example.app"}}}, false)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "plain text XML", data: []byte(`<?xml version="1.0" encoding="utf-8"?><manifest package="com.example.app"/>`)},
+		{name: "truncated", data: valid[:len(valid)/2]},
+		{name: "no elements", data: valid[:8+le.Uint32(valid[12:])]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "no elements" {
+				// Only the string pool is kept, the document size is adjusted accordingly
+				binary.LittleEndian.PutUint32(tt.data[4:], uint32(len(tt.data)))
+			}
+			if _, err := ParseXML(tt.data); err == nil {
+				t.Errorf("ParseXML() expected error")
+			}
+		})
+	}
+}
+
+type testAttr struct {
+	name       string
+	resourceID uint32
+	value      string
+	dataType   byte
+	data       uint32
+}
+
+type testElement struct {
+	name     string
+	attrs    []testAttr
+	children []testElement
+}
+
+// encodeTestXML encodes the element tree in the Android binary XML format.
+func encodeTestXML(root testElement, utf8 bool) []byte {
+	// The names of attributes with a resource ID come first in the string pool, their indexes match the resource map.
+	var pool []string
+	var resourceIDs []uint32
+	indexes := map[string]uint32{}
+	addString := func(s string) uint32 {
+		if index, ok := indexes[s]; ok {
+			return index
+		}
+		indexes[s] = uint32(len(pool))
+		pool = append(pool, s)
+		return indexes[s]
+	}
+
+	var collectAttrs func(e testElement)
+	collectAttrs = func(e testElement) {
+		for _, attr := range e.attrs {
+			if attr.resourceID != 0 {
+				if _, ok := indexes[attr.name]; !ok {
+					addString(attr.name)
+					resourceIDs = append(resourceIDs, attr.resourceID)
+				}
+			}
+		}
+		for _, child := range e.children {
+			collectAttrs(child)
+		}
+	}
+	collectAttrs(root)
+	addString(androidNamespace)
+
+	var body bytes.Buffer
+	var encodeElement func(e testElement)
+	encodeElement = func(e testElement) {
+		var ext bytes.Buffer
+		write(&ext, uint32(noIndex), addString(e.name), uint16(xmlAttrExtSize), uint16(xmlAttrSize), uint16(len(e.attrs)), uint16(0), uint16(0), uint16(0))
+		for _, attr := range e.attrs {
+			namespace := uint32(noIndex)
+			if attr.resourceID != 0 {
+				namespace = addString(androidNamespace)
+			}
+			rawValue := uint32(noIndex)
+			dataType, data := attr.dataType, attr.data
+			if dataType == 0 {
+				rawValue = addString(attr.value)
+				dataType, data = typeString, rawValue
+			}
+			write(&ext, namespace, addString(attr.name), rawValue, uint16(8), byte(0), dataType, data)
+		}
+		writeChunk(&body, chunkXMLStartElement, xmlNodeHeaderSize, append(nodeHeader(), ext.Bytes()...))
+
+		for _, child := range e.children {
+			encodeElement(child)
+		}
+
+		var end bytes.Buffer
+		write(&end, uint32(noIndex), addString(e.name))
+		writeChunk(&body, chunkXMLEndElement, xmlNodeHeaderSize, append(nodeHeader(), end.Bytes()...))
+	}
+	encodeElement(root)
+
+	var doc bytes.Buffer
+	doc.Write(encodeStringPool(pool, utf8))
+	var resourceMap bytes.Buffer
+	for _, id := range resourceIDs {
+		write(&resourceMap, id)
+	}
+	writeChunk(&doc, chunkXMLResourceMap, chunkHeaderSize, resourceMap.Bytes())
+	doc.Write(body.Bytes())
+
+	var out bytes.Buffer
+	writeChunk(&out, chunkXML, chunkHeaderSize, doc.Bytes())
+	return out.Bytes()
+}
+
+func encodeStringPool(pool []string, utf8 bool) []byte {
+	var offsets, data bytes.Buffer
+	for _, s := range pool {
+		write(&offsets, uint32(data.Len()))
+		if utf8 {
+			write(&data, byte(len(utf16.Encode([]rune(s)))), byte(len(s)))
+			data.WriteString(s)
+			data.WriteByte(0)
+		} else {
+			units := utf16.Encode([]rune(s))
+			write(&data, uint16(len(units)))
+			write(&data, units)
+			write(&data, uint16(0))
+		}
+	}
+	for data.Len()%4 != 0 {
+		data.WriteByte(0)
+	}
+
+	var flags uint32
+	if utf8 {
+		flags = stringPoolUTF8Flag
+	}
+
+	var content bytes.Buffer
+	write(&content, uint32(len(pool)), uint32(0), flags, uint32(stringPoolHeaderSize+offsets.Len()), uint32(0))
+	content.Write(offsets.Bytes())
+	content.Write(data.Bytes())
+
+	var out bytes.Buffer
+	writeChunk(&out, chunkStringPool, stringPoolHeaderSize, content.Bytes())
+	return out.Bytes()
+}
+
+func nodeHeader() []byte {
+	var b bytes.Buffer
+	write(&b, uint32(1), uint32(noIndex)) // line number, comment
+	return b.Bytes()
+}
+
+// writeChunk writes a chunk header followed by the content, the content starts with the rest of the chunk header.
+func writeChunk(w *bytes.Buffer, typ uint16, headerSize int, content []byte) {
+	write(w, typ, uint16(headerSize), uint32(chunkHeaderSize+len(content)))
+	w.Write(content)
+}
+
+func write(w *bytes.Buffer, values ...interface{}) {
+	for _, v := range values {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package apk
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// DEX header fields, see: https://source.android.com/docs/core/runtime/dex-format#header-item
+const (
+	dexMagic               = "dex\n"
+	dexHeaderSize          = 0x70
+	dexStringIDsSizeOffset = 0x38
+	dexStringIDsOffOffset  = 0x3c
+	dexTypeIDsSizeOffset   = 0x40
+	dexTypeIDsOffOffset    = 0x44
+	dexFieldIDsSizeOffset  = 0x50
+	dexMethodIDsSizeOffset = 0x58
+	dexClassDefsSizeOffset = 0x60
+	dexClassDefsOffOffset  = 0x64
+	dexClassDefSize        = 0x20
+)
+
+// DexFile holds the reference counts of a DEX file, a DEX file can reference at most 65536 methods.
+type DexFile struct {
+	Name             string `json:"name"`
+	MethodReferences int    `json:"method_references"`
+	FieldReferences  int    `json:"field_references"`
+}
+
+// parseDex reads the reference counts and the names of the classes defined in the DEX file.
+func parseDex(name string, data []byte) (DexFile, []string, error) {
+	if len(data) < dexHeaderSize || string(data[:len(dexMagic)]) != dexMagic {
+		return DexFile{}, nil, fmt.Errorf("%s is not a DEX file", name)
+	}
+
+	dex := DexFile{
+		Name:             name,
+		MethodReferences: int(binary.LittleEndian.Uint32(data[dexMethodIDsSizeOffset:])),
+		FieldReferences:  int(binary.LittleEndian.Uint32(data[dexFieldIDsSizeOffset:])),
+	}
+
+	classDefsSize := binary.LittleEndian.Uint32(data[dexClassDefsSizeOffset:])
+	classDefsOff := binary.LittleEndian.Uint32(data[dexClassDefsOffOffset:])
+	typeIDsSize := binary.LittleEndian.Uint32(data[dexTypeIDsSizeOffset:])
+	typeIDsOff := binary.LittleEndian.Uint32(data[dexTypeIDsOffOffset:])
+	stringIDsSize := binary.LittleEndian.Uint32(data[dexStringIDsSizeOffset:])
+	stringIDsOff := binary.LittleEndian.Uint32(data[dexStringIDsOffOffset:])
+
+	// The sizes come from the (untrusted) header, the sections must fit in the file before anything is allocated for them.
+	for _, section := range []struct {
+		name     string
+		off      uint32
+		size     uint32
+		itemSize uint64
+	}{
+		{"string_ids", stringIDsOff, stringIDsSize, 4},
+		{"type_ids", typeIDsOff, typeIDsSize, 4},
+		{"class_defs", classDefsOff, classDefsSize, dexClassDefSize},
+	} {
+		if uint64(section.off)+uint64(section.size)*section.itemSize > uint64(len(data)) {
+			return DexFile{}, nil, fmt.Errorf("%s: %s section out of bounds", name, section.name)
+		}
+	}
+
+	u32 := func(off uint64) (uint32, error) {
+		if off+4 > uint64(len(data)) {
+			return 0, fmt.Errorf("%s: offset %d out of bounds", name, off)
+		}
+		return binary.LittleEndian.Uint32(data[off:]), nil
+	}
+
+	classes := make([]string, 0, classDefsSize)
+	for i := uint64(0); i < uint64(classDefsSize); i++ {
+		// class_def_item.class_idx => type_id_item.descriptor_idx => string_id_item.string_data_off
+		classIdx, err := u32(uint64(classDefsOff) + i*dexClassDefSize)
+		if err != nil {
+			return DexFile{}, nil, err
+		}
+		if classIdx >= typeIDsSize {
+			return DexFile{}, nil, fmt.Errorf("%s: invalid class type index: %d", name, classIdx)
+		}
+		descriptorIdx, err := u32(uint64(typeIDsOff) + uint64(classIdx)*4)
+		if err != nil {
+			return DexFile{}, nil, err
+		}
+		if descriptorIdx >= stringIDsSize {
+			return DexFile{}, nil, fmt.Errorf("%s: invalid descriptor string index: %d", name, descriptorIdx)
+		}
+		stringDataOff, err := u32(uint64(stringIDsOff) + uint64(descriptorIdx)*4)
+		if err != nil {
+			return DexFile{}, nil, err
+		}
+		descriptor, err := dexString(data, stringDataOff)
+		if err != nil {
+			return DexFile{}, nil, fmt.Errorf("%s: %v", name, err)
+		}
+		classes = append(classes, className(descriptor))
+	}
+
+	return dex, classes, nil
+}
+
+// dexString reads a string_data_item: the ULEB128 UTF-16 length followed by the null terminated MUTF-8 bytes.
+// Class descriptors are ASCII in practice, the bytes are returned as they are.
+func dexString(data []byte, off uint32) (string, error) {
+	pos := int(off)
+	for ; pos < len(data) && data[pos]&0x80 != 0; pos++ {
+	}
+	pos++
+	for end := pos; end < len(data); end++ {
+		if data[end] == 0 {
+			return string(data[pos:end]), nil
+		}
+	}
+	return "", fmt.Errorf("unterminated string at offset %d", off)
+}
+
+// className converts a type descriptor to a class name: Lcom/example/Foo; => com.example.Foo
+func className(descriptor string) string {
+	if strings.HasPrefix(descriptor, "L") && strings.HasSuffix(descriptor, ";") {
+		descriptor = descriptor[1 : len(descriptor)-1]
+	}
+	return strings.Replace(descriptor, "/", ".", -1)
+}
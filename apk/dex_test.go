@@ -0,0 +1,87 @@
+package apk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func Test_parseDex(t *testing.T) {
+	data := testDexWithClasses(5, 3, "Lcom/example/app/MainActivity;", "Lcom/example/app/MainActivity$1;")
+
+	dex, classes, err := parseDex("classes.dex", data)
+	if err != nil {
+		t.Fatalf("parseDex() error = %v", err)
+	}
+	if want := (DexFile{Name: "classes.dex", MethodReferences: 5, FieldReferences: 3}); dex != want {
+		t.Errorf("parseDex() = %v, want %v", dex, want)
+	}
+	if want := []string{"com.example.app.MainActivity", "com.example.app.MainActivity$1"}; !reflect.DeepEqual(classes, want) {
+		t.Errorf("parseDex() classes = %v, want %v", classes, want)
+	}
+}
+
+func Test_parseDex_invalidClassIndex(t *testing.T) {
+	data := testDexWithClasses(0, 0, "Lcom/example/A;")
+	// Point the class definition to a missing type
+	classDefsOff := binary.LittleEndian.Uint32(data[dexClassDefsOffOffset:])
+	binary.LittleEndian.PutUint32(data[classDefsOff:], 7)
+
+	if _, _, err := parseDex("classes.dex", data); err == nil {
+		t.Errorf("parseDex() expected an error")
+	}
+}
+
+func Test_parseDex_sectionOutOfBounds(t *testing.T) {
+	for _, offset := range []int{dexStringIDsSizeOffset, dexTypeIDsSizeOffset, dexClassDefsSizeOffset} {
+		data := testDexWithClasses(0, 0, "Lcom/example/A;")
+		// A corrupted header claims a huge section, it must be rejected before anything is allocated for it
+		binary.LittleEndian.PutUint32(data[offset:], 0xffffffff)
+
+		if _, _, err := parseDex("classes.dex", data); err == nil {
+			t.Errorf("parseDex() expected an error for the size at offset %#x", offset)
+		}
+	}
+}
+
+func testDex(methods, fields uint32) []byte {
+	return testDexWithClasses(methods, fields)
+}
+
+// testDexWithClasses encodes a DEX file with the header, the string and type IDs and the class definitions
+// of the given class descriptors, the other sections are left out.
+func testDexWithClasses(methods, fields uint32, descriptors ...string) []byte {
+	n := uint32(len(descriptors))
+	stringIDsOff := uint32(dexHeaderSize)
+	typeIDsOff := stringIDsOff + 4*n
+	classDefsOff := typeIDsOff + 4*n
+	stringDataOff := classDefsOff + dexClassDefSize*n
+
+	var stringIDs, typeIDs, classDefs, stringData bytes.Buffer
+	for i, descriptor := range descriptors {
+		write(&stringIDs, stringDataOff+uint32(stringData.Len()))
+		stringData.WriteByte(byte(len(descriptor))) // ULEB128 length, the test descriptors are shorter than 128
+		stringData.WriteString(descriptor)
+		stringData.WriteByte(0)
+
+		write(&typeIDs, uint32(i))
+
+		classDef := make([]byte, dexClassDefSize)
+		binary.LittleEndian.PutUint32(classDef, uint32(i))
+		classDefs.Write(classDef)
+	}
+
+	header := make([]byte, dexHeaderSize)
+	copy(header, dexMagic+"035\x00")
+	binary.LittleEndian.PutUint32(header[dexStringIDsSizeOffset:], n)
+	binary.LittleEndian.PutUint32(header[dexStringIDsOffOffset:], stringIDsOff)
+	binary.LittleEndian.PutUint32(header[dexTypeIDsSizeOffset:], n)
+	binary.LittleEndian.PutUint32(header[dexTypeIDsOffOffset:], typeIDsOff)
+	binary.LittleEndian.PutUint32(header[dexFieldIDsSizeOffset:], fields)
+	binary.LittleEndian.PutUint32(header[dexMethodIDsSizeOffset:], methods)
+	binary.LittleEndian.PutUint32(header[dexClassDefsSizeOffset:], n)
+	binary.LittleEndian.PutUint32(header[dexClassDefsOffOffset:], classDefsOff)
+
+	return bytes.Join([][]byte{header, stringIDs.Bytes(), typeIDs.Bytes(), classDefs.Bytes(), stringData.Bytes()}, nil)
+}
@@ -0,0 +1,111 @@
+package apk
+
+import (
+	"archive/zip"
+	"fmt"
+	"strings"
+)
+
+// ManifestEntryName is the path of the binary manifest in an APK.
+const ManifestEntryName = "AndroidManifest.xml"
+
+// Instrumentation is an <instrumentation> element of a test APK's manifest.
+type Instrumentation struct {
+	Name          string
+	TargetPackage string
+}
+
+// Manifest holds the AndroidManifest.xml values of an APK.
+type Manifest struct {
+	Package          string
+	VersionCode      string
+	VersionName      string
+	MinSDKVersion    string
+	TargetSDKVersion string
+	Instrumentations []Instrumentation
+}
+
+// ParseManifest reads the manifest values from the decoded AndroidManifest.xml.
+func ParseManifest(root *Element) (Manifest, error) {
+	if root.Name != "manifest" {
+		return Manifest{}, fmt.Errorf("unexpected root element: %s", root.Name)
+	}
+
+	pkg, ok := root.Attr("package")
+	if !ok || pkg == "" {
+		return Manifest{}, fmt.Errorf("package attribute not found")
+	}
+
+	manifest := Manifest{Package: pkg}
+	manifest.VersionCode, _ = root.Attr("versionCode")
+	manifest.VersionName, _ = root.Attr("versionName")
+	for _, element := range root.ChildrenByName("uses-sdk") {
+		manifest.MinSDKVersion, _ = element.Attr("minSdkVersion")
+		manifest.TargetSDKVersion, _ = element.Attr("targetSdkVersion")
+	}
+	// Without an explicit value the minSdkVersion defaults to 1 and the targetSdkVersion to the minSdkVersion.
+	if manifest.MinSDKVersion == "" {
+		manifest.MinSDKVersion = "1"
+	}
+	if manifest.TargetSDKVersion == "" {
+		manifest.TargetSDKVersion = manifest.MinSDKVersion
+	}
+	for _, element := range root.ChildrenByName("instrumentation") {
+		name, _ := element.Attr("name")
+		targetPackage, _ := element.Attr("targetPackage")
+		manifest.Instrumentations = append(manifest.Instrumentations, Instrumentation{
+			Name:          qualifiedClassName(pkg, name),
+			TargetPackage: targetPackage,
+		})
+	}
+
+	return manifest, nil
+}
+
+// qualifiedClassName resolves class names relative to the package, like: .TestRunner => com.example.TestRunner
+func qualifiedClassName(pkg, name string) string {
+	if strings.HasPrefix(name, ".") {
+		return pkg + name
+	}
+	return name
+}
+
+// ReadManifest decodes the AndroidManifest.xml of the given APK.
+func ReadManifest(apkPth string) (Manifest, error) {
+	root, err := ReadManifestXML(apkPth)
+	if err != nil {
+		return Manifest{}, err
+	}
+	return ParseManifest(root)
+}
+
+// ReadManifestXML returns the root element of the given APK's binary AndroidManifest.xml.
+func ReadManifestXML(apkPth string) (*Element, error) {
+	r, err := zip.OpenReader(apkPth)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	data, err := readZipEntry(&r.Reader, ManifestEntryName)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := ParseXML(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", ManifestEntryName, err)
+	}
+	return root, nil
+}
+
+func readZipEntry(r *zip.Reader, name string) ([]byte, error) {
+	for _, f := range r.File {
+		if f.Name == name {
+			return readZipFile(f)
+		}
+	}
+	return nil, fmt.Errorf("%s not found", name)
+}
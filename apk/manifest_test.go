@@ -0,0 +1,131 @@
+package apk
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_ReadManifest(t *testing.T) {
+	testManifest := testElement{
+		name: "manifest",
+		attrs: []testAttr{
+			{name: "versionCode", resourceID: 0x0101021b, dataType: typeIntDec, data: 1042},
+			{name: "versionName", resourceID: 0x0101021c, value: "1.4.2-staging"},
+			{name: "package", value: "com.example.app.test"},
+		},
+		children: []testElement{
+			{
+				name: "uses-sdk",
+				attrs: []testAttr{
+					{name: "minSdkVersion", resourceID: 0x0101020c, dataType: typeIntDec, data: 23},
+					{name: "targetSdkVersion", resourceID: 0x01010270, dataType: typeIntDec, data: 34},
+				},
+			},
+			{
+				name: "instrumentation",
+				attrs: []testAttr{
+					{name: "name", resourceID: 0x01010003, value: "androidx.test.runner.AndroidJUnitRunner"},
+					{name: "targetPackage", resourceID: 0x01010021, value: "com.example.app"},
+				},
+			},
+			{
+				name: "instrumentation",
+				attrs: []testAttr{
+					{name: "name", resourceID: 0x01010003, value: ".CustomRunner"},
+					{name: "targetPackage", resourceID: 0x01010021, value: "com.example.app"},
+				},
+			},
+		},
+	}
+
+	pth := writeTestAPK(t, map[string][]byte{
+		ManifestEntryName: encodeTestXML(testManifest, false),
+		"classes.dex":     []byte("dex\n035\x00"),
+	})
+
+	got, err := ReadManifest(pth)
+	if err != nil {
+		t.Fatalf("ReadManifest() error = %v", err)
+	}
+
+	want := Manifest{
+		Package:          "com.example.app.test",
+		VersionCode:      "1042",
+		VersionName:      "1.4.2-staging",
+		MinSDKVersion:    "23",
+		TargetSDKVersion: "34",
+		Instrumentations: []Instrumentation{
+			{Name: "androidx.test.runner.AndroidJUnitRunner", TargetPackage: "com.example.app"},
+			{Name: "com.example.app.test.CustomRunner", TargetPackage: "com.example.app"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadManifest() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_ParseManifest_defaultSDKVersions(t *testing.T) {
+	root, err := ParseXML(encodeTestXML(testElement{name: "manifest", attrs: []testAttr{{name: "package", value: "com.example.app"}}}, false))
+	if err != nil {
+		t.Fatalf("ParseXML() error = %v", err)
+	}
+
+	got, err := ParseManifest(root)
+	if err != nil {
+		t.Fatalf("ParseManifest() error = %v", err)
+	}
+	if got.MinSDKVersion != "1" || got.TargetSDKVersion != "1" {
+		t.Errorf("ParseManifest() minSdkVersion = %s, targetSdkVersion = %s, want 1, 1", got.MinSDKVersion, got.TargetSDKVersion)
+	}
+}
+
+func Test_ReadManifest_errors(t *testing.T) {
+	noManifest := writeTestAPK(t, map[string][]byte{"classes.dex": []byte("dex\n035\x00")})
+	if _, err := ReadManifest(noManifest); err == nil {
+		t.Errorf("ReadManifest() expected error for APK without manifest")
+	}
+
+	noPackage := writeTestAPK(t, map[string][]byte{ManifestEntryName: encodeTestXML(testElement{name: "manifest"}, false)})
+	if _, err := ReadManifest(noPackage); err == nil {
+		t.Errorf("ReadManifest() expected error for manifest without package")
+	}
+
+	notZip := filepath.Join(t.TempDir(), "app.apk")
+	if err := ioutil.WriteFile(notZip, []byte("not a zip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadManifest(notZip); err == nil {
+		t.Errorf("ReadManifest() expected error for invalid APK")
+	}
+}
+
+// writeTestAPK creates a ZIP archive with the given entries.
+func writeTestAPK(t *testing.T, entries map[string][]byte) string {
+	pth := filepath.Join(t.TempDir(), "test.apk")
+	f, err := os.Create(pth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := zip.NewWriter(f)
+	for name, content := range entries {
+		entry, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := entry.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return pth
+}
@@ -0,0 +1,324 @@
+package apk
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// APK signature schemes, from the newest to the oldest
+const (
+	SchemeV3 = "v3"
+	SchemeV2 = "v2"
+	SchemeV1 = "v1"
+)
+
+// Schemes lists the supported APK signature schemes in order of preference.
+var Schemes = []string{SchemeV3, SchemeV2, SchemeV1}
+
+// APK Signing Block, see: https://source.android.com/docs/security/features/apksigning/v2#apk-signing-block
+const (
+	signingBlockMagic      = "APK Sig Block 42"
+	signingBlockFooterSize = 24 // size of block (uint64) + magic
+	signatureSchemeV2ID    = 0x7109871a
+	signatureSchemeV3ID    = 0xf05368c0
+
+	eocdSignature      = 0x06054b50
+	eocdMinSize        = 22
+	eocdMaxCommentSize = 0xffff
+)
+
+// Signer is the certificate of an APK signer.
+type Signer struct {
+	Certificate *x509.Certificate
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the signer certificate.
+func (s Signer) Fingerprint() string {
+	return fmt.Sprintf("%x", sha256.Sum256(s.Certificate.Raw))
+}
+
+// Signatures holds the signers of an APK by signature scheme.
+type Signatures map[string][]Signer
+
+// Fingerprints returns the sorted, unique signer certificate fingerprints of the given scheme.
+func (s Signatures) Fingerprints(scheme string) []string {
+	found := map[string]bool{}
+	var fingerprints []string
+	for _, signer := range s[scheme] {
+		fingerprint := signer.Fingerprint()
+		if !found[fingerprint] {
+			found[fingerprint] = true
+			fingerprints = append(fingerprints, fingerprint)
+		}
+	}
+	sort.Strings(fingerprints)
+	return fingerprints
+}
+
+// ReadSignatures reads the signer certificates of the APK Signature Scheme v2 and v3 blocks
+// and of the v1 (JAR) signature files. The signatures themselves are not verified.
+func ReadSignatures(apkPth string) (Signatures, error) {
+	f, err := os.Open(apkPth)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	signatures := Signatures{}
+
+	block, err := readSigningBlock(f, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	if block != nil {
+		pairs, err := signingBlockPairs(block)
+		if err != nil {
+			return nil, err
+		}
+		for id, scheme := range map[uint32]string{signatureSchemeV2ID: SchemeV2, signatureSchemeV3ID: SchemeV3} {
+			value, ok := pairs[id]
+			if !ok {
+				continue
+			}
+			signers, err := parseSchemeSigners(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid APK Signature Scheme %s block: %v", scheme, err)
+			}
+			signatures[scheme] = signers
+		}
+	}
+
+	zr, err := zip.NewReader(f, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	v1Signers, err := jarSigners(zr)
+	if err != nil {
+		return nil, err
+	}
+	if len(v1Signers) > 0 {
+		signatures[SchemeV1] = v1Signers
+	}
+
+	return signatures, nil
+}
+
+// readSigningBlock returns the APK Signing Block, which is located right before the ZIP Central Directory.
+// Returns nil if the APK has no signing block (it is not signed with the v2+ schemes).
+func readSigningBlock(r io.ReaderAt, size int64) ([]byte, error) {
+	cdOffset, err := centralDirectoryOffset(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if cdOffset < signingBlockFooterSize+8 {
+		return nil, nil
+	}
+
+	footer := make([]byte, signingBlockFooterSize)
+	if _, err := r.ReadAt(footer, cdOffset-signingBlockFooterSize); err != nil {
+		return nil, err
+	}
+	if string(footer[8:]) != signingBlockMagic {
+		return nil, nil
+	}
+
+	blockSize := int64(binary.LittleEndian.Uint64(footer))
+	if blockSize < signingBlockFooterSize || blockSize+8 > cdOffset {
+		return nil, fmt.Errorf("invalid APK Signing Block size: %d", blockSize)
+	}
+
+	block := make([]byte, blockSize+8)
+	if _, err := r.ReadAt(block, cdOffset-blockSize-8); err != nil {
+		return nil, err
+	}
+	if int64(binary.LittleEndian.Uint64(block)) != blockSize {
+		return nil, fmt.Errorf("APK Signing Block header and footer sizes do not match")
+	}
+	return block, nil
+}
+
+// centralDirectoryOffset reads the Central Directory offset from the ZIP End of Central Directory record.
+func centralDirectoryOffset(r io.ReaderAt, size int64) (int64, error) {
+	if size < eocdMinSize {
+		return 0, fmt.Errorf("not a ZIP archive: too small")
+	}
+
+	tailSize := int64(eocdMinSize + eocdMaxCommentSize)
+	if tailSize > size {
+		tailSize = size
+	}
+	tail := make([]byte, tailSize)
+	if _, err := r.ReadAt(tail, size-tailSize); err != nil {
+		return 0, err
+	}
+
+	for i := len(tail) - eocdMinSize; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(tail[i:]) != eocdSignature {
+			continue
+		}
+		commentSize := int(binary.LittleEndian.Uint16(tail[i+20:]))
+		if i+eocdMinSize+commentSize != len(tail) {
+			continue
+		}
+		return int64(binary.LittleEndian.Uint32(tail[i+16:])), nil
+	}
+	return 0, fmt.Errorf("not a ZIP archive: End of Central Directory record not found")
+}
+
+// signingBlockPairs returns the ID-value pairs of the signing block.
+func signingBlockPairs(block []byte) (map[uint32][]byte, error) {
+	pairs := map[uint32][]byte{}
+	data := block[8 : len(block)-signingBlockFooterSize]
+	for len(data) > 0 {
+		if len(data) < 12 {
+			return nil, fmt.Errorf("truncated APK Signing Block pair")
+		}
+		pairLen := binary.LittleEndian.Uint64(data)
+		if pairLen < 4 || pairLen > uint64(len(data)-8) {
+			return nil, fmt.Errorf("invalid APK Signing Block pair length: %d", pairLen)
+		}
+		id := binary.LittleEndian.Uint32(data[8:])
+		pairs[id] = data[12 : 8+pairLen]
+		data = data[8+pairLen:]
+	}
+	return pairs, nil
+}
+
+// parseSchemeSigners parses the signers of a v2 or v3 scheme block. Both schemes store a sequence of signers,
+// each starting with the signed data which starts with the digests followed by the certificates.
+// The first certificate belongs to the signer.
+func parseSchemeSigners(value []byte) ([]Signer, error) {
+	signersData, _, err := lengthPrefixed(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var signers []Signer
+	for len(signersData) > 0 {
+		var signer []byte
+		if signer, signersData, err = lengthPrefixed(signersData); err != nil {
+			return nil, err
+		}
+		signedData, _, err := lengthPrefixed(signer)
+		if err != nil {
+			return nil, err
+		}
+		_, rest, err := lengthPrefixed(signedData) // digests
+		if err != nil {
+			return nil, err
+		}
+		certificates, _, err := lengthPrefixed(rest)
+		if err != nil {
+			return nil, err
+		}
+		certificate, _, err := lengthPrefixed(certificates)
+		if err != nil {
+			return nil, fmt.Errorf("no signer certificate: %v", err)
+		}
+
+		cert, err := x509.ParseCertificate(certificate)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, Signer{Certificate: cert})
+	}
+
+	if len(signers) == 0 {
+		return nil, fmt.Errorf("no signers")
+	}
+	return signers, nil
+}
+
+func lengthPrefixed(data []byte) (value []byte, rest []byte, err error) {
+	if len(data) < 4 {
+		return nil, nil, fmt.Errorf("truncated length prefix")
+	}
+	length := binary.LittleEndian.Uint32(data)
+	if uint64(length) > uint64(len(data)-4) {
+		return nil, nil, fmt.Errorf("length %d out of bounds (%d)", length, len(data)-4)
+	}
+	return data[4 : 4+length], data[4+length:], nil
+}
+
+// PKCS #7 structures of the v1 (JAR) signature block files, see: RFC 2315
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      asn1.RawValue
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      asn1.RawValue
+}
+
+// jarSigners returns the certificates of the META-INF/*.RSA, *.DSA and *.EC signature block files.
+func jarSigners(r *zip.Reader) ([]Signer, error) {
+	var signers []Signer
+	for _, f := range r.File {
+		dir, name := path.Split(f.Name)
+		ext := strings.ToUpper(path.Ext(name))
+		if dir != "META-INF/" || (ext != ".RSA" && ext != ".DSA" && ext != ".EC") {
+			continue
+		}
+
+		data, err := readZipFile(f)
+		if err != nil {
+			return nil, err
+		}
+		certs, err := parsePKCS7Certificates(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signature block file %s: %v", f.Name, err)
+		}
+		for _, cert := range certs {
+			signers = append(signers, Signer{Certificate: cert})
+		}
+	}
+	return signers, nil
+}
+
+func parsePKCS7Certificates(data []byte) ([]*x509.Certificate, error) {
+	var contentInfo pkcs7ContentInfo
+	if _, err := asn1.Unmarshal(data, &contentInfo); err != nil {
+		return nil, err
+	}
+	var signedData pkcs7SignedData
+	if _, err := asn1.Unmarshal(contentInfo.Content.Bytes, &signedData); err != nil {
+		return nil, err
+	}
+	if len(signedData.Certificates.Bytes) == 0 {
+		return nil, fmt.Errorf("no certificates")
+	}
+	return x509.ParseCertificates(signedData.Certificates.Bytes)
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+	return ioutil.ReadAll(rc)
+}
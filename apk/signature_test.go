@@ -0,0 +1,160 @@
+package apk
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_ReadSignatures(t *testing.T) {
+	key := newTestCertificate(t, "key")
+	otherKey := newTestCertificate(t, "other key")
+
+	pth := writeSignedTestAPK(t, map[uint32][]*x509.Certificate{
+		signatureSchemeV2ID: {key},
+		signatureSchemeV3ID: {otherKey},
+	}, key)
+
+	got, err := ReadSignatures(pth)
+	if err != nil {
+		t.Fatalf("ReadSignatures() error = %v", err)
+	}
+
+	want := map[string][]string{
+		SchemeV1: {fingerprint(key)},
+		SchemeV2: {fingerprint(key)},
+		SchemeV3: {fingerprint(otherKey)},
+	}
+	for _, scheme := range Schemes {
+		if fingerprints := got.Fingerprints(scheme); !reflect.DeepEqual(fingerprints, want[scheme]) {
+			t.Errorf("ReadSignatures() %s fingerprints = %v, want %v", scheme, fingerprints, want[scheme])
+		}
+	}
+}
+
+func Test_ReadSignatures_unsigned(t *testing.T) {
+	pth := writeTestAPK(t, map[string][]byte{"classes.dex": nil})
+
+	got, err := ReadSignatures(pth)
+	if err != nil {
+		t.Fatalf("ReadSignatures() error = %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("ReadSignatures() = %v, want no signatures", got)
+	}
+}
+
+func newTestCertificate(t *testing.T, commonName string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func fingerprint(cert *x509.Certificate) string {
+	return Signer{Certificate: cert}.Fingerprint()
+}
+
+// writeSignedTestAPK creates an APK with a v1 signature block file and an APK Signing Block with the given schemes.
+// Only the certificates are written, the digests and the signatures are left empty.
+func writeSignedTestAPK(t *testing.T, schemes map[uint32][]*x509.Certificate, v1Cert *x509.Certificate) string {
+	unsigned := writeTestAPK(t, map[string][]byte{
+		"classes.dex":       nil,
+		"META-INF/CERT.RSA": encodeTestPKCS7(t, v1Cert),
+	})
+	data, err := ioutil.ReadFile(unsigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pairs bytes.Buffer
+	for id, certs := range schemes {
+		var signers bytes.Buffer
+		for _, cert := range certs {
+			certificates := prefixLength(prefixLength(cert.Raw))
+			signedData := prefixLength(append(prefixLength(nil), certificates...))
+			signers.Write(prefixLength(signedData))
+		}
+		value := prefixLength(signers.Bytes())
+		write(&pairs, uint64(len(value)+4), id)
+		pairs.Write(value)
+	}
+
+	blockSize := uint64(pairs.Len() + signingBlockFooterSize)
+	var block bytes.Buffer
+	write(&block, blockSize)
+	block.Write(pairs.Bytes())
+	write(&block, blockSize)
+	block.WriteString(signingBlockMagic)
+
+	// The signing block is inserted before the Central Directory, its offset in the EOCD record is updated accordingly.
+	eocd := len(data) - eocdMinSize
+	cdOffset := binary.LittleEndian.Uint32(data[eocd+16:])
+	binary.LittleEndian.PutUint32(data[eocd+16:], cdOffset+uint32(block.Len()))
+
+	signed := append(append(append([]byte{}, data[:cdOffset]...), block.Bytes()...), data[cdOffset:]...)
+	pth := filepath.Join(t.TempDir(), "signed.apk")
+	if err := ioutil.WriteFile(pth, signed, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return pth
+}
+
+func prefixLength(data []byte) []byte {
+	var b bytes.Buffer
+	write(&b, uint32(len(data)))
+	b.Write(data)
+	return b.Bytes()
+}
+
+func encodeTestPKCS7(t *testing.T, cert *x509.Certificate) []byte {
+	empty := asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true}
+	signedData, err := asn1.Marshal(pkcs7SignedData{
+		Version:          1,
+		DigestAlgorithms: empty,
+		ContentInfo:      asn1.RawValue{FullBytes: mustMarshal(t, struct{ ContentType asn1.ObjectIdentifier }{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}})},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: cert.Raw},
+		SignerInfos:      empty,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mustMarshal(t, pkcs7ContentInfo{
+		ContentType: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2},
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData},
+	})
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	data, err := asn1.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,104 @@
+package apk
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// EntrySize is the size of an APK entry, or of a top-level directory (like: res, lib).
+type EntrySize struct {
+	Name             string `json:"name"`
+	CompressedSize   uint64 `json:"compressed_size"`
+	UncompressedSize uint64 `json:"uncompressed_size"`
+}
+
+// SizeReport describes the size and the DEX files of an APK.
+type SizeReport struct {
+	Size             int64       `json:"size"`
+	Entries          []EntrySize `json:"entries"`
+	DexFiles         []DexFile   `json:"dex_files"`
+	MethodReferences int         `json:"method_references"`
+	FieldReferences  int         `json:"field_references"`
+	// Files and Classes list every entry and every class defined in the DEX files, to compare APKs with each other.
+	// They are not part of the JSON report.
+	Files   []EntrySize `json:"-"`
+	Classes []string    `json:"-"`
+}
+
+// AnalyzeSize reports the size of the APK's top-level entries and the reference counts of its DEX files.
+// The entries are sorted by their compressed size, the largest first, the files and the classes by name.
+func AnalyzeSize(apkPth string) (SizeReport, error) {
+	info, err := os.Stat(apkPth)
+	if err != nil {
+		return SizeReport{}, err
+	}
+
+	r, err := zip.OpenReader(apkPth)
+	if err != nil {
+		return SizeReport{}, err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	report := SizeReport{Size: info.Size()}
+	entries := map[string]*EntrySize{}
+	for _, f := range r.File {
+		name := strings.SplitN(f.Name, "/", 2)[0]
+		entry, ok := entries[name]
+		if !ok {
+			entry = &EntrySize{Name: name}
+			entries[name] = entry
+		}
+		entry.CompressedSize += f.CompressedSize64
+		entry.UncompressedSize += f.UncompressedSize64
+		report.Files = append(report.Files, EntrySize{Name: f.Name, CompressedSize: f.CompressedSize64, UncompressedSize: f.UncompressedSize64})
+
+		if !dexEntryRegexp.MatchString(f.Name) {
+			continue
+		}
+		data, err := readZipFile(f)
+		if err != nil {
+			return SizeReport{}, err
+		}
+		dex, classes, err := parseDex(f.Name, data)
+		if err != nil {
+			return SizeReport{}, err
+		}
+		report.DexFiles = append(report.DexFiles, dex)
+		report.Classes = append(report.Classes, classes...)
+		report.MethodReferences += dex.MethodReferences
+		report.FieldReferences += dex.FieldReferences
+	}
+
+	for _, entry := range entries {
+		report.Entries = append(report.Entries, *entry)
+	}
+	sort.Slice(report.Entries, func(i, j int) bool {
+		if report.Entries[i].CompressedSize != report.Entries[j].CompressedSize {
+			return report.Entries[i].CompressedSize > report.Entries[j].CompressedSize
+		}
+		return report.Entries[i].Name < report.Entries[j].Name
+	})
+	sort.Slice(report.Files, func(i, j int) bool {
+		return report.Files[i].Name < report.Files[j].Name
+	})
+	sort.Strings(report.Classes)
+	sort.Slice(report.DexFiles, func(i, j int) bool {
+		return dexIndex(report.DexFiles[i].Name) < dexIndex(report.DexFiles[j].Name)
+	})
+
+	return report, nil
+}
+
+// dexIndex returns the order of the DEX file: classes.dex => 1, classes2.dex => 2, ...
+func dexIndex(name string) int {
+	var index int
+	if _, err := fmt.Sscanf(name, "classes%d.dex", &index); err != nil {
+		return 1
+	}
+	return index
+}
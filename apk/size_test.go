@@ -0,0 +1,73 @@
+package apk
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_AnalyzeSize(t *testing.T) {
+	dex := testDexWithClasses(1200, 300, "Lcom/example/B;", "Lcom/example/A;")
+	pth := writeTestAPK(t, map[string][]byte{
+		"classes.dex":       dex,
+		"classes2.dex":      testDex(64000, 20000),
+		"res/layout/a.xml":  make([]byte, 100),
+		"res/layout/b.xml":  make([]byte, 200),
+		"lib/x86/libfoo.so": make([]byte, 50),
+		ManifestEntryName:   nil,
+	})
+
+	got, err := AnalyzeSize(pth)
+	if err != nil {
+		t.Fatalf("AnalyzeSize() error = %v", err)
+	}
+
+	wantDexFiles := []DexFile{
+		{Name: "classes.dex", MethodReferences: 1200, FieldReferences: 300},
+		{Name: "classes2.dex", MethodReferences: 64000, FieldReferences: 20000},
+	}
+	if !reflect.DeepEqual(got.DexFiles, wantDexFiles) {
+		t.Errorf("AnalyzeSize() dex files = %v, want %v", got.DexFiles, wantDexFiles)
+	}
+	if got.MethodReferences != 65200 || got.FieldReferences != 20300 {
+		t.Errorf("AnalyzeSize() references = %d methods, %d fields, want 65200 methods, 20300 fields", got.MethodReferences, got.FieldReferences)
+	}
+
+	if want := []string{"com.example.A", "com.example.B"}; !reflect.DeepEqual(got.Classes, want) {
+		t.Errorf("AnalyzeSize() classes = %v, want %v", got.Classes, want)
+	}
+
+	uncompressed := map[string]uint64{}
+	for _, entry := range got.Entries {
+		uncompressed[entry.Name] = entry.UncompressedSize
+	}
+	wantUncompressed := map[string]uint64{
+		"classes.dex":     uint64(len(dex)),
+		"classes2.dex":    dexHeaderSize,
+		"res":             300,
+		"lib":             50,
+		ManifestEntryName: 0,
+	}
+	if !reflect.DeepEqual(uncompressed, wantUncompressed) {
+		t.Errorf("AnalyzeSize() uncompressed sizes = %v, want %v", uncompressed, wantUncompressed)
+	}
+}
+
+func Test_AnalyzeSize_invalidDex(t *testing.T) {
+	pth := writeTestAPK(t, map[string][]byte{"classes.dex": []byte("not a dex")})
+	if _, err := AnalyzeSize(pth); err == nil {
+		t.Errorf("AnalyzeSize() expected an error for an invalid DEX file")
+	}
+}
+
+func Test_SizeReport_json(t *testing.T) {
+	report := SizeReport{Size: 10, Files: []EntrySize{{Name: "classes.dex"}}, Classes: []string{"Lcom/example/A;"}}
+	content, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "classes.dex") || strings.Contains(string(content), "Lcom/example/A;") {
+		t.Errorf("json.Marshal() = %s, want no files and classes", content)
+	}
+}
@@ -0,0 +1,58 @@
+package apk
+
+import (
+	"archive/zip"
+	"fmt"
+	"regexp"
+)
+
+// dexEntryRegexp matches the DEX files of an APK: classes.dex, classes2.dex, ...
+var dexEntryRegexp = regexp.MustCompile(`^classes\d*\.dex$`)
+
+// IsDexEntry tells whether the APK entry is a DEX file.
+func IsDexEntry(name string) bool {
+	return dexEntryRegexp.MatchString(name)
+}
+
+// Validate checks that the APK is structurally complete: its ZIP Central Directory is readable,
+// it contains a decodable AndroidManifest.xml and at least one classes*.dex.
+// A test APK must also declare an <instrumentation> element.
+// Truncated APKs (for example left over from an interrupted build) fail the Central Directory check.
+func Validate(apkPth string, testAPK bool) error {
+	r, err := zip.OpenReader(apkPth)
+	if err != nil {
+		return fmt.Errorf("unreadable ZIP central directory: %v", err)
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	hasDex := false
+	for _, f := range r.File {
+		if dexEntryRegexp.MatchString(f.Name) {
+			hasDex = true
+			break
+		}
+	}
+	if !hasDex {
+		return fmt.Errorf("no classes*.dex found")
+	}
+
+	data, err := readZipEntry(&r.Reader, ManifestEntryName)
+	if err != nil {
+		return err
+	}
+	root, err := ParseXML(data)
+	if err != nil {
+		return fmt.Errorf("failed to decode %s: %v", ManifestEntryName, err)
+	}
+	manifest, err := ParseManifest(root)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %v", ManifestEntryName, err)
+	}
+
+	if testAPK && len(manifest.Instrumentations) == 0 {
+		return fmt.Errorf("the test APK does not declare an <instrumentation> element")
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package apk
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Validate(t *testing.T) {
+	appManifest := encodeTestXML(testElement{
+		name:  "manifest",
+		attrs: []testAttr{{name: "package", value: "com.example.app"}},
+	}, false)
+	testManifest := encodeTestXML(testElement{
+		name:  "manifest",
+		attrs: []testAttr{{name: "package", value: "com.example.app.test"}},
+		children: []testElement{
+			{
+				name: "instrumentation",
+				attrs: []testAttr{
+					{name: "name", resourceID: 0x01010003, value: "androidx.test.runner.AndroidJUnitRunner"},
+					{name: "targetPackage", resourceID: 0x01010021, value: "com.example.app"},
+				},
+			},
+		},
+	}, false)
+	dex := []byte("dex\n035\x00")
+
+	validAPK := writeTestAPK(t, map[string][]byte{ManifestEntryName: appManifest, "classes.dex": dex})
+	data, err := ioutil.ReadFile(validAPK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncatedAPK := filepath.Join(t.TempDir(), "truncated.apk")
+	if err := ioutil.WriteFile(truncatedAPK, data[:len(data)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		pth     string
+		testAPK bool
+		wantErr bool
+	}{
+		{
+			name: "valid app APK",
+			pth:  validAPK,
+		},
+		{
+			name:    "valid test APK with multidex",
+			pth:     writeTestAPK(t, map[string][]byte{ManifestEntryName: testManifest, "classes2.dex": dex}),
+			testAPK: true,
+		},
+		{
+			name:    "truncated APK",
+			pth:     truncatedAPK,
+			wantErr: true,
+		},
+		{
+			name:    "missing manifest",
+			pth:     writeTestAPK(t, map[string][]byte{"classes.dex": dex}),
+			wantErr: true,
+		},
+		{
+			name:    "missing dex",
+			pth:     writeTestAPK(t, map[string][]byte{ManifestEntryName: appManifest, "lib/x86/classes.dex": dex}),
+			wantErr: true,
+		},
+		{
+			name:    "test APK without instrumentation",
+			pth:     validAPK,
+			testAPK: true,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.pth, tt.testAPK); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/bitrise-steplib/bitrise-step-android-build-for-ui-testing/apk"
+)
+
+const (
+	appMinSDKVersionEnvKey            = "BITRISE_APP_MIN_SDK_VERSION"
+	appTargetSDKVersionEnvKey         = "BITRISE_APP_TARGET_SDK_VERSION"
+	appVersionCodeEnvKey              = "BITRISE_APP_VERSION_CODE"
+	appVersionNameEnvKey              = "BITRISE_APP_VERSION_NAME"
+	appNativeABIsEnvKey               = "BITRISE_APP_NATIVE_ABIS"
+	recommendedEmulatorAPILevelEnvKey = "BITRISE_RECOMMENDED_EMULATOR_API_LEVEL"
+	recommendedEmulatorABIEnvKey      = "BITRISE_RECOMMENDED_EMULATOR_ABI"
+)
+
+// Emulator system image ABIs in order of preference, by the host architecture (runtime.GOARCH).
+// Images matching the host architecture run without binary translation.
+var emulatorABIPreferences = map[string][]string{
+	"amd64": {"x86_64", "x86", "arm64-v8a", "armeabi-v7a"},
+	"arm64": {"arm64-v8a", "armeabi-v7a", "x86_64", "x86"},
+}
+
+// appInfo describes the built app, it is used to select the emulator to run the tests on.
+type appInfo struct {
+	MinSDKVersion    string
+	TargetSDKVersion string
+	VersionCode      string
+	VersionName      string
+	NativeABIs       []string
+	EmulatorAPILevel string
+	EmulatorABI      string
+}
+
+func newAppInfo(manifest apk.Manifest, nativeABIs []string, hostArch string) appInfo {
+	return appInfo{
+		MinSDKVersion:    manifest.MinSDKVersion,
+		TargetSDKVersion: manifest.TargetSDKVersion,
+		VersionCode:      manifest.VersionCode,
+		VersionName:      manifest.VersionName,
+		NativeABIs:       nativeABIs,
+		// The app is tested on the platform version it targets.
+		EmulatorAPILevel: manifest.TargetSDKVersion,
+		EmulatorABI:      recommendedEmulatorABI(nativeABIs, hostArch),
+	}
+}
+
+// recommendedEmulatorABI returns the preferred emulator ABI which the app has native libraries for.
+// Apps without native libraries run on any ABI, for these the host's native ABI is recommended.
+func recommendedEmulatorABI(nativeABIs []string, hostArch string) string {
+	preferences, ok := emulatorABIPreferences[hostArch]
+	if !ok {
+		preferences = emulatorABIPreferences["amd64"]
+	}
+
+	for _, abi := range preferences {
+		if len(nativeABIs) == 0 {
+			return abi
+		}
+		for _, nativeABI := range nativeABIs {
+			if nativeABI == abi {
+				return abi
+			}
+		}
+	}
+	return preferences[0]
+}
+
+func (i appInfo) envs() [][2]string {
+	return [][2]string{
+		{appMinSDKVersionEnvKey, i.MinSDKVersion},
+		{appTargetSDKVersionEnvKey, i.TargetSDKVersion},
+		{appVersionCodeEnvKey, i.VersionCode},
+		{appVersionNameEnvKey, i.VersionName},
+		{appNativeABIsEnvKey, strings.Join(i.NativeABIs, "|")},
+		{recommendedEmulatorAPILevelEnvKey, i.EmulatorAPILevel},
+		{recommendedEmulatorABIEnvKey, i.EmulatorABI},
+	}
+}
+
+func printAppInfo(info appInfo) {
+	nativeABIs := strings.Join(info.NativeABIs, ", ")
+	if nativeABIs == "" {
+		nativeABIs = "none"
+	}
+
+	logger.Printf("  minSdkVersion:    %s", info.MinSDKVersion)
+	logger.Printf("  targetSdkVersion: %s", info.TargetSDKVersion)
+	logger.Printf("  versionCode:      %s", info.VersionCode)
+	logger.Printf("  versionName:      %s", info.VersionName)
+	logger.Printf("  Native ABIs:      %s", nativeABIs)
+	logger.Printf("  Recommended emulator: API level %s, %s", info.EmulatorAPILevel, info.EmulatorABI)
+}
@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+func Test_recommendedEmulatorABI(t *testing.T) {
+	tests := []struct {
+		name       string
+		nativeABIs []string
+		hostArch   string
+		want       string
+	}{
+		{
+			name:     "no native libraries on x86_64 host",
+			hostArch: "amd64",
+			want:     "x86_64",
+		},
+		{
+			name:     "no native libraries on Apple Silicon host",
+			hostArch: "arm64",
+			want:     "arm64-v8a",
+		},
+		{
+			name:       "all ABIs on x86_64 host",
+			nativeABIs: []string{"arm64-v8a", "armeabi-v7a", "x86", "x86_64"},
+			hostArch:   "amd64",
+			want:       "x86_64",
+		},
+		{
+			name:       "ARM only app on x86_64 host",
+			nativeABIs: []string{"arm64-v8a", "armeabi-v7a"},
+			hostArch:   "amd64",
+			want:       "arm64-v8a",
+		},
+		{
+			name:       "32-bit x86 only app",
+			nativeABIs: []string{"x86"},
+			hostArch:   "amd64",
+			want:       "x86",
+		},
+		{
+			name:       "unknown ABIs",
+			nativeABIs: []string{"mips"},
+			hostArch:   "amd64",
+			want:       "x86_64",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := recommendedEmulatorABI(tt.nativeABIs, tt.hostArch); got != tt.want {
+				t.Errorf("recommendedEmulatorABI() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
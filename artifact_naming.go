@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-android/gradle"
+	"github.com/bitrise-io/go-utils/pathutil"
+	"github.com/bitrise-steplib/bitrise-step-android-build-for-ui-testing/apk"
+)
+
+// Collision policies, applied when an artifact with the same name is already in the deploy dir.
+const (
+	collisionTimestamp = "timestamp"
+	collisionCounter   = "counter"
+	collisionOverwrite = "overwrite"
+	collisionFail      = "fail"
+)
+
+// Artifact types of the naming template.
+const (
+	appArtifactType   = "app"
+	splitArtifactType = "split"
+	testArtifactType  = "test"
+)
+
+var namePlaceholderRegexp = regexp.MustCompile(`\{(\w+)\}`)
+
+// artifactNamer names the exported APKs by a template, like: {module}-{variant}-{type}-{versionName}
+// The .apk extension is appended to the rendered name. An empty template keeps the names given by Gradle.
+type artifactNamer struct {
+	Template        string
+	ProjectLocation string
+	Module          string
+	Variant         string
+
+	commit string
+}
+
+// name renders the template for the given APK, {split} is the split filters of the APK, like x86_64 or universal.
+func (n *artifactNamer) name(artifact gradle.Artifact, artifactType, split string) (string, error) {
+	if n.Template == "" {
+		return artifact.Name, nil
+	}
+
+	var err error
+	name := namePlaceholderRegexp.ReplaceAllStringFunc(n.Template, func(placeholder string) string {
+		var value string
+		switch placeholder {
+		case "{module}":
+			value = moduleName(n.Module)
+		case "{variant}":
+			value = n.Variant
+		case "{type}":
+			value = artifactType
+		case "{split}":
+			value = split
+		case "{versionName}":
+			manifest, manifestErr := apk.ReadManifest(artifact.Path)
+			if manifestErr != nil {
+				err = fmt.Errorf("failed to read the versionName of %s: %v", artifact.Name, manifestErr)
+			}
+			value = manifest.VersionName
+		case "{commit}":
+			value = n.shortCommit()
+		default:
+			err = fmt.Errorf("unknown placeholder in the artifact name template: %s", placeholder)
+		}
+		return sanitizeNameComponent(value)
+	})
+	if err != nil {
+		return "", err
+	}
+	return name + filepath.Ext(artifact.Name), nil
+}
+
+func (n *artifactNamer) shortCommit() string {
+	if n.commit == "" {
+		n.commit = gitCommit(n.ProjectLocation)
+		if len(n.commit) > 7 {
+			n.commit = n.commit[:7]
+		}
+		if n.commit == "" {
+			n.commit = "unknown"
+		}
+	}
+	return n.commit
+}
+
+// sanitizeNameComponent replaces the characters which are not safe in file names, like path separators and spaces.
+func sanitizeNameComponent(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == ' ' || r == '\t' || r == '\n' {
+			return '-'
+		}
+		return r
+	}, value)
+}
+
+// nameArtifacts renames the APKs of the given type by the template.
+func nameArtifacts(namer *artifactNamer, set apkSet, artifacts []gradle.Artifact, artifactType string) ([]gradle.Artifact, error) {
+	var named []gradle.Artifact
+	for _, artifact := range artifacts {
+		name, err := namer.name(artifact, artifactType, set.split(artifact).String())
+		if err != nil {
+			return nil, err
+		}
+		artifact.Name = name
+		named = append(named, artifact)
+	}
+	return named, nil
+}
+
+// checkUniqueNames checks that the template gives a different name to every exported APK,
+// the collision policy only handles the artifacts already in the deploy dir.
+func checkUniqueNames(original, named []gradle.Artifact) error {
+	names := map[string]string{}
+	for i, artifact := range named {
+		if other, ok := names[artifact.Name]; ok {
+			return fmt.Errorf("the artifact name template gives the same name (%s) to %s and %s, use the {type} and {split} placeholders", artifact.Name, other, original[i].Name)
+		}
+		names[artifact.Name] = original[i].Name
+	}
+	return nil
+}
+
+// resolveNameCollision returns the name to export the artifact with, according to the collision policy.
+func resolveNameCollision(deployDir, name, policy string) (string, error) {
+	exists, err := pathutil.IsPathExists(filepath.Join(deployDir, name))
+	if err != nil {
+		return "", fmt.Errorf("failed to check path, error: %v", err)
+	}
+	if !exists {
+		return name, nil
+	}
+
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	switch policy {
+	case collisionOverwrite:
+		return name, nil
+	case collisionFail:
+		return "", fmt.Errorf("an artifact named %s already exists in the deploy dir", name)
+	case collisionCounter:
+		return firstFreeName(deployDir, base, ext)
+	default:
+		timestamped := fmt.Sprintf("%s-%s%s", base, time.Now().Format("20060102150405"), ext)
+		// Artifacts exported within the same second get a counter too.
+		return resolveNameCollision(deployDir, timestamped, collisionCounter)
+	}
+}
+
+// writeDeployFile writes a generated file (like a report) into the deploy dir, named according to the collision policy.
+func writeDeployFile(deployDir, name string, content []byte, collisionPolicy string) (string, error) {
+	name, err := resolveNameCollision(deployDir, name, collisionPolicy)
+	if err != nil {
+		return "", err
+	}
+	pth := filepath.Join(deployDir, name)
+	if err := ioutil.WriteFile(pth, content, 0644); err != nil {
+		return "", err
+	}
+	return pth, nil
+}
+
+// firstFreeName returns the first <base>-<n><ext> name which does not exist in the deploy dir.
+func firstFreeName(deployDir, base, ext string) (string, error) {
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s-%d%s", base, i, ext)
+		if exists, err := pathutil.IsPathExists(filepath.Join(deployDir, candidate)); err != nil {
+			return "", fmt.Errorf("failed to check path, error: %v", err)
+		} else if !exists {
+			return candidate, nil
+		}
+	}
+}
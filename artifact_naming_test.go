@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/bitrise-io/go-android/gradle"
+)
+
+func Test_artifactNamer_name(t *testing.T) {
+	artifact := gradle.Artifact{Path: "/outputs/app-x86_64-debug.apk", Name: "app-x86_64-debug.apk"}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{name: "no template", template: "", want: "app-x86_64-debug.apk"},
+		{name: "template", template: "{module}-{variant}-{type}-{split}-{commit}", want: "login-freeDebug-split-x86_64-abc1234.apk"},
+		{name: "unknown placeholder", template: "{module}-{flavor}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			namer := &artifactNamer{Template: tt.template, Module: "feature:login", Variant: "freeDebug", commit: "abc1234"}
+			got, err := namer.name(artifact, splitArtifactType, "x86_64")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("name() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("name() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_resolveNameCollision(t *testing.T) {
+	deployDir := t.TempDir()
+	writeTestFile(t, filepath.Join(deployDir, "app-debug.apk"), "app")
+	writeTestFile(t, filepath.Join(deployDir, "app-debug-1.apk"), "app")
+
+	tests := []struct {
+		policy  string
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{policy: collisionFail, name: "app-release.apk", want: "app-release.apk"},
+		{policy: collisionFail, name: "app-debug.apk", wantErr: true},
+		{policy: collisionOverwrite, name: "app-debug.apk", want: "app-debug.apk"},
+		{policy: collisionCounter, name: "app-debug.apk", want: "app-debug-2.apk"},
+		{policy: collisionTimestamp, name: "app-debug.apk", want: `^app-debug-\d{14}\.apk$`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy+" "+tt.name, func(t *testing.T) {
+			got, err := resolveNameCollision(deployDir, tt.name, tt.policy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveNameCollision() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.policy == collisionTimestamp {
+				if !regexp.MustCompile(tt.want).MatchString(got) {
+					t.Errorf("resolveNameCollision() = %v, want match %v", got, tt.want)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("resolveNameCollision() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_checkUniqueNames(t *testing.T) {
+	original := []gradle.Artifact{{Name: "app-x86-debug.apk"}, {Name: "app-arm64-v8a-debug.apk"}, {Name: "app-debug-androidTest.apk"}}
+
+	unique := []gradle.Artifact{{Name: "app-debug-app-x86.apk"}, {Name: "app-debug-split-arm64-v8a.apk"}, {Name: "app-debug-test-universal.apk"}}
+	if err := checkUniqueNames(original, unique); err != nil {
+		t.Errorf("checkUniqueNames() error = %v", err)
+	}
+
+	noSplit := []gradle.Artifact{{Name: "app-debug-app.apk"}, {Name: "app-debug-app.apk"}, {Name: "app-debug-test.apk"}}
+	if err := checkUniqueNames(original, noSplit); err == nil {
+		t.Errorf("checkUniqueNames() expected error for a template without {split}")
+	}
+
+	noType := []gradle.Artifact{{Name: "app-debug-x86.apk"}, {Name: "app-debug-arm64-v8a.apk"}, {Name: "app-debug-x86.apk"}}
+	if err := checkUniqueNames(original, noType); err == nil {
+		t.Errorf("checkUniqueNames() expected error for a template without {type}")
+	}
+}
+
+func Test_writeDeployFile(t *testing.T) {
+	deployDir := t.TempDir()
+	writeTestFile(t, filepath.Join(deployDir, "flank.yml"), "previous")
+
+	pth, err := writeDeployFile(deployDir, "flank.yml", []byte("current"), collisionCounter)
+	if err != nil {
+		t.Fatalf("writeDeployFile() error = %v", err)
+	}
+	if want := filepath.Join(deployDir, "flank-1.yml"); pth != want {
+		t.Errorf("writeDeployFile() = %v, want %v", pth, want)
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(deployDir, "flank.yml")); err != nil || string(content) != "previous" {
+		t.Errorf("writeDeployFile() overwrote the existing file: %s, %v", content, err)
+	}
+
+	if _, err := writeDeployFile(deployDir, "flank.yml", []byte("current"), collisionFail); err == nil {
+		t.Errorf("writeDeployFile() expected error with the fail policy")
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-android/gradle"
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+const (
+	reuseAppAPKDir  = "app"
+	reuseTestAPKDir = "test"
+)
+
+// Directories which are generated by the build or by tooling, these are not part of the source tree hash.
+var sourceTreeHashSkippedDirs = []string{".git", ".gradle", ".idea", ".cxx", ".externalNativeBuild", "build", "node_modules"}
+
+// artifactCache stores app and test APK pairs in a local directory, keyed by the build inputs.
+// An entry is a directory named after the key, containing the app APK in the app subdirectory
+// and the test APK in the test subdirectory.
+type artifactCache struct {
+	dir string
+}
+
+func newArtifactCache(dir string) artifactCache {
+	return artifactCache{dir: dir}
+}
+
+// Lookup returns the app and test APKs stored for the given key.
+func (c artifactCache) Lookup(key string) (app gradle.Artifact, test gradle.Artifact, found bool, err error) {
+	entryDir := filepath.Join(c.dir, key)
+	exists, err := pathutil.IsDirExists(entryDir)
+	if err != nil || !exists {
+		return gradle.Artifact{}, gradle.Artifact{}, false, err
+	}
+
+	app, err = singleEntryArtifact(filepath.Join(entryDir, reuseAppAPKDir))
+	if err != nil {
+		return gradle.Artifact{}, gradle.Artifact{}, false, err
+	}
+	test, err = singleEntryArtifact(filepath.Join(entryDir, reuseTestAPKDir))
+	if err != nil {
+		return gradle.Artifact{}, gradle.Artifact{}, false, err
+	}
+
+	return app, test, true, nil
+}
+
+// Store saves the app and test APKs for the given key, replacing the existing entry if any.
+func (c artifactCache) Store(key, appAPKPth, testAPKPth string) error {
+	if err := pathutil.EnsureDirExist(c.dir); err != nil {
+		return err
+	}
+
+	// The entry is assembled in a temporary directory first, so that a failed or interrupted store
+	// never leaves a partial entry behind.
+	tmpDir, err := ioutil.TempDir(c.dir, key+"-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			logger.Warnf("Failed to remove %s: %v", tmpDir, err)
+		}
+	}()
+
+	for dir, pth := range map[string]string{reuseAppAPKDir: appAPKPth, reuseTestAPKDir: testAPKPth} {
+		if err := pathutil.EnsureDirExist(filepath.Join(tmpDir, dir)); err != nil {
+			return err
+		}
+		if err := copyFile(pth, filepath.Join(tmpDir, dir, filepath.Base(pth))); err != nil {
+			return err
+		}
+	}
+
+	entryDir := filepath.Join(c.dir, key)
+	if err := os.RemoveAll(entryDir); err != nil {
+		return err
+	}
+	return os.Rename(tmpDir, entryDir)
+}
+
+func singleEntryArtifact(dir string) (gradle.Artifact, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return gradle.Artifact{}, err
+	}
+	if len(entries) != 1 {
+		return gradle.Artifact{}, fmt.Errorf("expected a single APK in %s, found: %d", dir, len(entries))
+	}
+	return gradle.Artifact{Path: filepath.Join(dir, entries[0].Name()), Name: entries[0].Name()}, nil
+}
+
+// artifactReuseKey computes the key of an APK pair built from the given inputs.
+func artifactReuseKey(projectLocation, module, variant, abi string, args []string) (string, error) {
+	revision, err := sourceRevision(projectLocation)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	for _, component := range append([]string{revision, module, variant, abi}, args...) {
+		if _, err := fmt.Fprintf(h, "%d:%s\n", len(component), component); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// sourceRevision identifies the sources of the project: the git commit if the project is a clean git
+// working tree, otherwise the hash of the source tree.
+func sourceRevision(projectLocation string) (string, error) {
+	opts := command.Opts{Dir: projectLocation}
+	commit, err := cmdFactory.Create("git", []string{"rev-parse", "HEAD"}, &opts).RunAndReturnTrimmedOutput()
+	if err == nil {
+		status, err := cmdFactory.Create("git", []string{"status", "--porcelain"}, &opts).RunAndReturnTrimmedOutput()
+		if err == nil && status == "" {
+			return "git:" + commit, nil
+		}
+		logger.Printf("The git working tree has local changes, using the source tree hash")
+	}
+
+	hash, err := sourceTreeHash(projectLocation)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute source tree hash: %v", err)
+	}
+	return "tree:" + hash, nil
+}
+
+// sourceTreeHash computes a SHA-256 hash over the relative paths and contents of the project files.
+func sourceTreeHash(root string) (string, error) {
+	var pths []string
+	if err := filepath.Walk(root, func(pth string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			for _, skipped := range sourceTreeHashSkippedDirs {
+				if pth != root && info.Name() == skipped {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		relPth, err := filepath.Rel(root, pth)
+		if err != nil {
+			return err
+		}
+		pths = append(pths, relPth)
+		return nil
+	}); err != nil {
+		return "", err
+	}
+
+	sort.Strings(pths)
+
+	h := sha256.New()
+	for _, relPth := range pths {
+		if _, err := io.WriteString(h, filepath.ToSlash(relPth)+"\x00"); err != nil {
+			return "", err
+		}
+		if err := hashFileInto(h, filepath.Join(root, relPth)); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+func hashFileInto(w io.Writer, pth string) error {
+	f, err := os.Open(pth)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			logger.Warnf("Failed to close %s: %v", pth, err)
+		}
+	}()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := in.Close(); err != nil {
+			logger.Warnf("Failed to close %s: %v", src, err)
+		}
+	}()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func printReusedArtifacts(dir string, apks []gradle.Artifact) {
+	logger.Printf("Reusing APKs from %s:", dir)
+	for i, apk := range apks {
+		logger.Printf("%d. %s", i+1, strings.TrimPrefix(apk.Path, dir+string(filepath.Separator)))
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_artifactCache(t *testing.T) {
+	srcDir := t.TempDir()
+	appAPK := writeTestFile(t, filepath.Join(srcDir, "app-debug.apk"), "app")
+	testAPK := writeTestFile(t, filepath.Join(srcDir, "app-debug-androidTest.apk"), "test")
+
+	cache := newArtifactCache(filepath.Join(t.TempDir(), "reuse"))
+
+	if _, _, found, err := cache.Lookup("key"); err != nil || found {
+		t.Fatalf("Lookup() on empty cache: found = %v, error = %v", found, err)
+	}
+
+	if err := cache.Store("key", appAPK, testAPK); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	app, test, found, err := cache.Lookup("key")
+	if err != nil || !found {
+		t.Fatalf("Lookup() found = %v, error = %v", found, err)
+	}
+	if app.Name != "app-debug.apk" || readTestFile(t, app.Path) != "app" {
+		t.Errorf("Lookup() app = %v", app)
+	}
+	if test.Name != "app-debug-androidTest.apk" || readTestFile(t, test.Path) != "test" {
+		t.Errorf("Lookup() test = %v", test)
+	}
+
+	if _, _, found, err := cache.Lookup("other-key"); err != nil || found {
+		t.Errorf("Lookup() with other key: found = %v, error = %v", found, err)
+	}
+}
+
+func Test_sourceTreeHash(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "build.gradle"), "plugins {}")
+	writeTestFile(t, filepath.Join(root, "app", "src", "Main.kt"), "fun main() {}")
+
+	hash, err := sourceTreeHash(root)
+	if err != nil {
+		t.Fatalf("sourceTreeHash() error = %v", err)
+	}
+
+	// Build outputs do not change the hash
+	writeTestFile(t, filepath.Join(root, "app", "build", "outputs", "apk", "app-debug.apk"), "apk")
+	writeTestFile(t, filepath.Join(root, ".gradle", "8.2", "checksums.lock"), "lock")
+	if got, err := sourceTreeHash(root); err != nil || got != hash {
+		t.Errorf("sourceTreeHash() after build = %s, %v, want %s", got, err, hash)
+	}
+
+	// Source changes do
+	writeTestFile(t, filepath.Join(root, "app", "src", "Main.kt"), "fun main() { println() }")
+	if got, err := sourceTreeHash(root); err != nil || got == hash {
+		t.Errorf("sourceTreeHash() after source change = %s, %v, want a different hash", got, err)
+	}
+}
+
+func writeTestFile(t *testing.T, pth, content string) string {
+	if err := os.MkdirAll(filepath.Dir(pth), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(pth, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return pth
+}
+
+func readTestFile(t *testing.T, pth string) string {
+	content, err := ioutil.ReadFile(pth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitrise-io/go-android/gradle"
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+// artifactSearch finds the artifacts matching a pattern. The search is scoped to the build/outputs directories
+// of the selected modules, the whole project is only walked if none of them exist.
+type artifactSearch struct {
+	ProjectLocation string
+	Modules         []string
+	// Excludes are glob patterns of the directories to skip, matched against the directory name
+	// and the path relative to the project, like: node_modules, .git, **/build/intermediates
+	Excludes    []string
+	Concurrency int
+}
+
+type artifactSearchResult struct {
+	Artifacts   []gradle.Artifact
+	Decisions   []patternDecision
+	ScannedDirs int64
+	Duration    time.Duration
+}
+
+func newArtifactSearch(projectLocation string, modules, excludes []string) artifactSearch {
+	var patterns []string
+	for _, exclude := range excludes {
+		if exclude = strings.TrimSpace(exclude); exclude != "" {
+			patterns = append(patterns, exclude)
+		}
+	}
+	return artifactSearch{
+		ProjectLocation: projectLocation,
+		Modules:         modules,
+		Excludes:        patterns,
+		Concurrency:     2 * runtime.NumCPU(),
+	}
+}
+
+// roots returns the build/outputs directories of the modules which exist, or the project root.
+func (s artifactSearch) roots() ([]string, error) {
+	var roots []string
+	for _, module := range s.Modules {
+		dir := filepath.Join(moduleDir(s.ProjectLocation, module), "build", "outputs")
+		if exists, err := pathutil.IsDirExists(dir); err != nil {
+			return nil, err
+		} else if exists {
+			roots = append(roots, dir)
+		}
+	}
+	if len(roots) == 0 {
+		roots = append(roots, s.ProjectLocation)
+	}
+	return roots, nil
+}
+
+func (s artifactSearch) excluded(dir string, patterns pathPatterns) bool {
+	rel := relativePath(s.ProjectLocation, dir)
+	for _, pattern := range s.Excludes {
+		if matchGlob(pattern, filepath.Base(dir)) || matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return patterns.excludesDir(s.ProjectLocation, dir)
+}
+
+// find returns the files selected by the patterns, sorted by path.
+// The directories are walked concurrently.
+func (s artifactSearch) find(patterns pathPatterns) (artifactSearchResult, error) {
+	started := time.Now()
+
+	roots, err := s.roots()
+	if err != nil {
+		return artifactSearchResult{}, err
+	}
+
+	concurrency := s.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	semaphore := make(chan struct{}, concurrency)
+
+	var (
+		mu          sync.Mutex
+		wg          sync.WaitGroup
+		artifacts   []gradle.Artifact
+		decisions   []patternDecision
+		scannedDirs int64
+	)
+
+	var walk func(dir string)
+	walk = func(dir string) {
+		defer wg.Done()
+
+		semaphore <- struct{}{}
+		entries, err := ioutil.ReadDir(dir)
+		<-semaphore
+		atomic.AddInt64(&scannedDirs, 1)
+		if err != nil {
+			logger.Warnf("failed to walk path: %s", err)
+			return
+		}
+
+		for _, entry := range entries {
+			pth := filepath.Join(dir, entry.Name())
+			if entry.IsDir() {
+				if !s.excluded(pth, patterns) {
+					wg.Add(1)
+					go walk(pth)
+				}
+				continue
+			}
+
+			decision := patterns.match(s.ProjectLocation, pth)
+			if decision == nil {
+				continue
+			}
+
+			mu.Lock()
+			decisions = append(decisions, *decision)
+			if decision.Selected {
+				artifacts = append(artifacts, gradle.Artifact{Path: pth, Name: entry.Name()})
+			}
+			mu.Unlock()
+		}
+	}
+
+	for _, root := range roots {
+		wg.Add(1)
+		go walk(root)
+	}
+	wg.Wait()
+
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].Path < artifacts[j].Path
+	})
+	sort.Slice(decisions, func(i, j int) bool {
+		return decisions[i].Path < decisions[j].Path
+	})
+
+	return artifactSearchResult{
+		Artifacts:   artifacts,
+		Decisions:   decisions,
+		ScannedDirs: scannedDirs,
+		Duration:    time.Since(started),
+	}, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_artifactSearch_find(t *testing.T) {
+	project := t.TempDir()
+	appAPK := writeTestFile(t, filepath.Join(project, "app", "build", "outputs", "apk", "debug", "app-debug.apk"), "")
+	testAPK := writeTestFile(t, filepath.Join(project, "app", "build", "outputs", "apk", "androidTest", "debug", "app-debug-androidTest.apk"), "")
+	writeTestFile(t, filepath.Join(project, "lib", "build", "outputs", "apk", "debug", "lib-debug.apk"), "")
+	writeTestFile(t, filepath.Join(project, "node_modules", "pkg", "build", "outputs", "apk", "debug", "pkg-debug.apk"), "")
+
+	tests := []struct {
+		name    string
+		modules []string
+		want    []string
+	}{
+		{
+			name:    "scoped to the module outputs",
+			modules: []string{"app"},
+			want:    []string{testAPK, appAPK},
+		},
+		{
+			name:    "walks the project without the excluded directories if the module has no outputs",
+			modules: []string{"missing"},
+			want:    []string{testAPK, appAPK, filepath.Join(project, "lib", "build", "outputs", "apk", "debug", "lib-debug.apk")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			search := newArtifactSearch(project, tt.modules, []string{"node_modules", " ", ".git"})
+			got, err := search.find(parsePathPatterns([]string{"**/build/outputs/apk/**/*.apk"}))
+			if err != nil {
+				t.Fatalf("find() error = %v", err)
+			}
+
+			var paths []string
+			for _, artifact := range got.Artifacts {
+				paths = append(paths, artifact.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.want) {
+				t.Errorf("find() = %v, want %v", paths, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bitrise-io/go-android/gradle"
+)
+
+const (
+	artifactStateNew       = "new"
+	artifactStateChanged   = "changed"
+	artifactStateUnchanged = "unchanged"
+)
+
+type artifactFile struct {
+	Size   int64
+	SHA256 string
+}
+
+// artifactSnapshot records the output files which exist before the build, by path.
+// The files found after the build are compared with it to tell the freshly built APKs from the stale ones,
+// for example the ones restored from a cache.
+type artifactSnapshot map[string]artifactFile
+
+func readArtifactFile(pth string) (artifactFile, error) {
+	info, err := os.Stat(pth)
+	if err != nil {
+		return artifactFile{}, err
+	}
+	hash, err := fileSHA256(pth)
+	if err != nil {
+		return artifactFile{}, err
+	}
+	return artifactFile{Size: info.Size(), SHA256: hash}, nil
+}
+
+func takeArtifactSnapshot(artifacts []gradle.Artifact) (artifactSnapshot, error) {
+	snapshot := artifactSnapshot{}
+	for _, artifact := range artifacts {
+		file, err := readArtifactFile(artifact.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to snapshot %s: %v", artifact.Path, err)
+		}
+		snapshot[artifact.Path] = file
+	}
+	return snapshot, nil
+}
+
+// state classifies the file as new, changed or unchanged since the snapshot.
+func (s artifactSnapshot) state(pth string) (string, error) {
+	before, ok := s[pth]
+	if !ok {
+		return artifactStateNew, nil
+	}
+	after, err := readArtifactFile(pth)
+	if err != nil {
+		return "", err
+	}
+	if after != before {
+		return artifactStateChanged, nil
+	}
+	return artifactStateUnchanged, nil
+}
+
+// freshArtifacts drops the unchanged artifacts if any of them was built.
+// If all of them are unchanged, they are kept with a warning, or an error is returned in strict mode.
+func (s artifactSnapshot) freshArtifacts(artifacts []gradle.Artifact, kind string, strict bool) ([]gradle.Artifact, map[string]string, error) {
+	states := map[string]string{}
+	var fresh []gradle.Artifact
+	for _, artifact := range artifacts {
+		state, err := s.state(artifact.Path)
+		if err != nil {
+			return nil, states, fmt.Errorf("failed to compare %s with the snapshot: %v", artifact.Path, err)
+		}
+		states[artifact.Path] = state
+		if state != artifactStateUnchanged {
+			fresh = append(fresh, artifact)
+		}
+	}
+
+	if len(fresh) > 0 || len(artifacts) == 0 {
+		return fresh, states, nil
+	}
+	if strict {
+		return nil, states, fmt.Errorf("the %s APKs are unchanged since before the build, they were not built by this step", kind)
+	}
+	logger.Warnf("The %s APKs are unchanged since before the build, exporting them anyway", kind)
+	return artifacts, states, nil
+}
+
+// freshAPKs selects the fresh app and test APKs of the set separately.
+// The states of all the APKs are returned, even if the selection fails.
+func (s artifactSnapshot) freshAPKs(set apkSet, strict bool) (apkSet, map[string]string, error) {
+	app, states, appErr := s.freshArtifacts(set.App, "app", strict)
+	test, testStates, testErr := s.freshArtifacts(set.Test, "test", strict)
+
+	if states == nil {
+		states = map[string]string{}
+	}
+	for pth, state := range testStates {
+		states[pth] = state
+	}
+
+	if appErr != nil {
+		return apkSet{}, states, appErr
+	}
+	if testErr != nil {
+		return apkSet{}, states, testErr
+	}
+	return apkSet{App: app, Test: test, Filters: set.Filters}, states, nil
+}
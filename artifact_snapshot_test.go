@@ -0,0 +1,83 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bitrise-io/go-android/gradle"
+)
+
+func Test_artifactSnapshot_state(t *testing.T) {
+	dir := t.TempDir()
+	unchanged := writeTestFile(t, filepath.Join(dir, "unchanged.apk"), "unchanged")
+	sameSize := writeTestFile(t, filepath.Join(dir, "same-size.apk"), "before")
+	resized := writeTestFile(t, filepath.Join(dir, "resized.apk"), "before")
+
+	snapshot, err := takeArtifactSnapshot([]gradle.Artifact{{Path: unchanged}, {Path: sameSize}, {Path: resized}})
+	if err != nil {
+		t.Fatalf("takeArtifactSnapshot() error = %v", err)
+	}
+
+	writeTestFile(t, sameSize, "after!")
+	writeTestFile(t, resized, "after the build")
+	added := writeTestFile(t, filepath.Join(dir, "new.apk"), "new")
+
+	tests := []struct {
+		pth  string
+		want string
+	}{
+		{pth: unchanged, want: artifactStateUnchanged},
+		{pth: sameSize, want: artifactStateChanged},
+		{pth: resized, want: artifactStateChanged},
+		{pth: added, want: artifactStateNew},
+	}
+	for _, tt := range tests {
+		t.Run(filepath.Base(tt.pth), func(t *testing.T) {
+			got, err := snapshot.state(tt.pth)
+			if err != nil {
+				t.Fatalf("state() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("state() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_artifactSnapshot_freshAPKs(t *testing.T) {
+	dir := t.TempDir()
+	staleApp := gradle.Artifact{Path: writeTestFile(t, filepath.Join(dir, "app-debug.apk"), "stale"), Name: "app-debug.apk"}
+	staleTest := gradle.Artifact{Path: writeTestFile(t, filepath.Join(dir, "app-debug-androidTest.apk"), "stale"), Name: "app-debug-androidTest.apk"}
+
+	snapshot, err := takeArtifactSnapshot([]gradle.Artifact{staleApp, staleTest})
+	if err != nil {
+		t.Fatalf("takeArtifactSnapshot() error = %v", err)
+	}
+
+	freshApp := gradle.Artifact{Path: writeTestFile(t, filepath.Join(dir, "app-x86-debug.apk"), "fresh"), Name: "app-x86-debug.apk"}
+	set := apkSet{App: []gradle.Artifact{staleApp, freshApp}, Test: []gradle.Artifact{staleTest}}
+
+	got, states, err := snapshot.freshAPKs(set, false)
+	if err != nil {
+		t.Fatalf("freshAPKs() error = %v", err)
+	}
+	want := apkSet{App: []gradle.Artifact{freshApp}, Test: []gradle.Artifact{staleTest}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("freshAPKs() = %v, want %v", got, want)
+	}
+	wantStates := map[string]string{
+		staleApp.Path:  artifactStateUnchanged,
+		freshApp.Path:  artifactStateNew,
+		staleTest.Path: artifactStateUnchanged,
+	}
+	if !reflect.DeepEqual(states, wantStates) {
+		t.Errorf("freshAPKs() states = %v, want %v", states, wantStates)
+	}
+
+	if _, states, err := snapshot.freshAPKs(set, true); err == nil {
+		t.Errorf("freshAPKs() expected an error for the unchanged test APK in strict mode")
+	} else if !reflect.DeepEqual(states, wantStates) {
+		t.Errorf("freshAPKs() states = %v, want %v", states, wantStates)
+	}
+}
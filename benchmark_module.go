@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/bitrise-io/go-android/gradle"
+	"github.com/bitrise-steplib/bitrise-step-android-build-for-ui-testing/apk"
+)
+
+// testPluginRegexp matches the Android test plugin applied in the build file of a benchmark module, like:
+//
+//	apply plugin: 'com.android.test'
+//	id("com.android.test")
+//	alias(libs.plugins.android.test)
+var testPluginRegexp = regexp.MustCompile(`com\.android\.test\b|libs\.plugins\.android\.test\b`)
+
+// targetProjectPathRegexp matches the app module a test module targets, like:
+//
+//	targetProjectPath = ":app"
+//	targetProjectPath ':app'
+var targetProjectPathRegexp = regexp.MustCompile(`targetProjectPath\s*=?\s*["']([^"']+)["']`)
+
+// isBenchmarkModule checks if the build file of the module applies the Android test plugin,
+// used by the Macrobenchmark and the Baseline Profile generator modules. Commented-out lines are ignored.
+func isBenchmarkModule(buildFileContent string) bool {
+	return testPluginRegexp.MatchString(stripComments(buildFileContent))
+}
+
+// benchmarkTargetModule returns the app module the benchmark module targets, like: :app => app
+func benchmarkTargetModule(projectLocation, module string) (string, error) {
+	buildFile, err := moduleBuildFile(projectLocation, module)
+	if err != nil {
+		return "", err
+	}
+	content, err := ioutil.ReadFile(buildFile)
+	if err != nil {
+		return "", err
+	}
+
+	match := targetProjectPathRegexp.FindStringSubmatch(stripComments(string(content)))
+	if match == nil {
+		return "", fmt.Errorf("no targetProjectPath found in %s", buildFile)
+	}
+	return strings.TrimPrefix(match[1], ":"), nil
+}
+
+// benchmarkVariants returns the variant of the benchmark module and the same variant of the app module it targets.
+// Test modules have no AndroidTest variants, the benchmark APK is built by the variant itself,
+// like :macrobenchmark:assembleBenchmarkRelease next to :app:assembleBenchmarkRelease.
+func benchmarkVariants(module, targetModule, variant string, variantsMap gradle.Variants) (gradle.Variants, error) {
+	filteredVariants := gradle.Variants{}
+	for _, m := range []string{module, targetModule} {
+		for _, v := range variantsMap[m] {
+			if strings.EqualFold(v, variant) {
+				filteredVariants[m] = []string{v}
+				break
+			}
+		}
+		if len(filteredVariants[m]) == 0 {
+			return nil, fmt.Errorf("variant: %s not found in %s module", variant, m)
+		}
+	}
+	return filteredVariants, nil
+}
+
+// matchBenchmarkPackage checks that the benchmark APK instruments the app APK, or instruments itself
+// (self-instrumenting Macrobenchmark and Baseline Profile generator modules, which drive the app through the shell).
+func matchBenchmarkPackage(appManifest, testManifest apk.Manifest) (testPackageInfo, error) {
+	info, err := matchTestPackage(appManifest, testManifest)
+	if err == nil {
+		return info, nil
+	}
+
+	info, selfErr := selfInstrumentingTestPackage(testManifest)
+	if selfErr != nil {
+		return testPackageInfo{}, err
+	}
+	info.AppPackage = appManifest.Package
+	return info, nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bitrise-io/go-android/gradle"
+	"github.com/bitrise-steplib/bitrise-step-android-build-for-ui-testing/apk"
+)
+
+func Test_isBenchmarkModule(t *testing.T) {
+	tests := []struct {
+		content string
+		want    bool
+	}{
+		{content: "apply plugin: 'com.android.test'", want: true},
+		{content: `plugins { id("com.android.test"); id("androidx.baselineprofile") }`, want: true},
+		{content: "plugins { alias(libs.plugins.android.test) }", want: true},
+		{content: `dependencies { implementation("com.android.testing:lib:1.0") }`, want: false},
+		{content: `plugins { id("com.android.application") }`, want: false},
+		{content: "plugins {\n    id(\"com.android.application\")\n    // id(\"com.android.test\")\n}", want: false},
+		{content: "/*\napply plugin: 'com.android.test'\n*/\napply plugin: 'com.android.application'", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.content, func(t *testing.T) {
+			if got := isBenchmarkModule(tt.content); got != tt.want {
+				t.Errorf("isBenchmarkModule() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_benchmarkTargetModule(t *testing.T) {
+	project := t.TempDir()
+	writeTestFile(t, filepath.Join(project, "macrobenchmark", "build.gradle.kts"), `android {
+    targetProjectPath = ":feature:app"
+}`)
+	writeTestFile(t, filepath.Join(project, "baselineprofile", "build.gradle"), "android {\n    targetProjectPath ':app'\n}")
+	writeTestFile(t, filepath.Join(project, "app", "build.gradle"), "apply plugin: 'com.android.application'")
+
+	tests := []struct {
+		module  string
+		want    string
+		wantErr bool
+	}{
+		{module: "macrobenchmark", want: "feature:app"},
+		{module: "baselineprofile", want: "app"},
+		{module: "app", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.module, func(t *testing.T) {
+			got, err := benchmarkTargetModule(project, tt.module)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("benchmarkTargetModule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("benchmarkTargetModule() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_benchmarkVariants(t *testing.T) {
+	variants := gradle.Variants{
+		"macrobenchmark": {"benchmark", "benchmarkRelease", "nonMinifiedRelease"},
+		"app":            {"benchmark", "benchmarkRelease", "debug", "debugAndroidTest", "nonMinifiedRelease", "release"},
+	}
+
+	got, err := benchmarkVariants("macrobenchmark", "app", "BenchmarkRelease", variants)
+	if err != nil {
+		t.Fatalf("benchmarkVariants() error = %v", err)
+	}
+	want := gradle.Variants{"macrobenchmark": {"benchmarkRelease"}, "app": {"benchmarkRelease"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("benchmarkVariants() = %v, want %v", got, want)
+	}
+
+	if _, err := benchmarkVariants("macrobenchmark", "app", "debug", variants); err == nil {
+		t.Errorf("benchmarkVariants() expected an error for a variant missing from the benchmark module")
+	}
+}
+
+func Test_matchBenchmarkPackage(t *testing.T) {
+	runner := "androidx.test.runner.AndroidJUnitRunner"
+	app := apk.Manifest{Package: "com.example"}
+
+	tests := []struct {
+		name     string
+		manifest apk.Manifest
+		want     testPackageInfo
+		wantErr  bool
+	}{
+		{
+			name: "self-instrumenting",
+			manifest: apk.Manifest{
+				Package:          "com.example.macrobenchmark",
+				Instrumentations: []apk.Instrumentation{{Name: runner, TargetPackage: "com.example.macrobenchmark"}},
+			},
+			want: testPackageInfo{
+				AppPackage:            "com.example",
+				TestPackage:           "com.example.macrobenchmark",
+				InstrumentationRunner: runner,
+				TargetPackage:         "com.example.macrobenchmark",
+			},
+		},
+		{
+			name: "instruments the app",
+			manifest: apk.Manifest{
+				Package:          "com.example.benchmark",
+				Instrumentations: []apk.Instrumentation{{Name: runner, TargetPackage: "com.example"}},
+			},
+			want: testPackageInfo{
+				AppPackage:            "com.example",
+				TestPackage:           "com.example.benchmark",
+				InstrumentationRunner: runner,
+				TargetPackage:         "com.example",
+			},
+		},
+		{
+			name: "instruments an other app",
+			manifest: apk.Manifest{
+				Package:          "com.example.benchmark",
+				Instrumentations: []apk.Instrumentation{{Name: runner, TargetPackage: "com.other"}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := matchBenchmarkPackage(app, tt.manifest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("matchBenchmarkPackage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("matchBenchmarkPackage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_findAPKs_benchmark(t *testing.T) {
+	project := t.TempDir()
+	appAPK := writeTestFile(t, filepath.Join(project, "app", "build", "outputs", "apk", "benchmarkRelease", "app-benchmarkRelease.apk"), "app")
+	writeTestFile(t, filepath.Join(project, "app", "build", "outputs", "apk", "benchmarkRelease", outputMetadataFileName), `{
+  "artifactType": {"type": "APK", "kind": "Directory"},
+  "variantName": "benchmarkRelease",
+  "elements": [{"type": "SINGLE", "filters": [], "outputFile": "app-benchmarkRelease.apk"}]
+}`)
+	benchmarkAPK := writeTestFile(t, filepath.Join(project, "macrobenchmark", "build", "outputs", "apk", "benchmarkRelease", "macrobenchmark-benchmarkRelease.apk"), "benchmark")
+	writeTestFile(t, filepath.Join(project, "macrobenchmark", "build", "outputs", "apk", "benchmarkRelease", outputMetadataFileName), `{
+  "artifactType": {"type": "APK", "kind": "Directory"},
+  "variantName": "benchmarkRelease",
+  "elements": [{"type": "SINGLE", "filters": [], "outputFile": "macrobenchmark-benchmarkRelease.apk"}]
+}`)
+
+	config := Configs{ProjectLocation: project, Module: "macrobenchmark", Variant: "benchmarkRelease"}
+	got, err := findAPKs(config, moduleTypeBenchmark, "app")
+	if err != nil {
+		t.Fatalf("findAPKs() error = %v", err)
+	}
+
+	want := apkSet{
+		App:     []gradle.Artifact{{Path: appAPK, Name: "app-benchmarkRelease.apk"}},
+		Test:    []gradle.Artifact{{Path: benchmarkAPK, Name: "macrobenchmark-benchmarkRelease.apk"}},
+		Filters: map[string][]outputFilter{appAPK: {}, benchmarkAPK: {}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findAPKs() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/fileutil"
+)
+
+const (
+	buildMetricsEnvKey   = "BITRISE_GRADLE_BUILD_METRICS_PATH"
+	buildMetricsFileName = "gradle-build-metrics.json"
+
+	procDir             = "/proc"
+	sampleInterval      = time.Second
+	clockTicksPerSecond = 100 // USER_HZ, the unit of utime and stime in /proc/<pid>/stat
+	gradleDaemonMarker  = "org.gradle.launcher.daemon.bootstrap.GradleDaemon"
+	statFieldsAfterComm = 22 // the number of fields we need after the "(comm)" part of /proc/<pid>/stat
+	statPPIDIndex       = 1
+	statUTimeIndex      = 11
+	statSTimeIndex      = 12
+	statRSSIndex        = 21
+)
+
+// BuildMetrics describes the resource usage of the Gradle build.
+type BuildMetrics struct {
+	DurationSeconds float64 `json:"duration_seconds"`
+	PeakRSSBytes    uint64  `json:"peak_rss_bytes"`
+	CPUTimeSeconds  float64 `json:"cpu_time_seconds"`
+	Samples         int     `json:"samples"`
+}
+
+type processStat struct {
+	pid      int
+	ppid     int
+	cpuTicks uint64
+	rssBytes uint64
+	cmdline  string
+}
+
+// parseProcessStat parses the content of a /proc/<pid>/stat file.
+func parseProcessStat(content string, pageSize int) (processStat, error) {
+	// Example content:
+	// 4242 (java) S 4200 4242 4200 0 -1 1077936128 ... 1500 300 0 0 20 0 52 0 1234 5678901234 123456 ...
+	// The command name is wrapped in parentheses and might contain spaces or parentheses itself.
+	commStart := strings.Index(content, "(")
+	commEnd := strings.LastIndex(content, ")")
+	if commStart == -1 || commEnd == -1 || commEnd < commStart {
+		return processStat{}, fmt.Errorf("invalid stat content: %s", content)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(content[:commStart]))
+	if err != nil {
+		return processStat{}, fmt.Errorf("invalid pid: %v", err)
+	}
+
+	fields := strings.Fields(content[commEnd+1:])
+	if len(fields) < statFieldsAfterComm {
+		return processStat{}, fmt.Errorf("invalid stat content, only %d fields found after the command name", len(fields))
+	}
+
+	ppid, err := strconv.Atoi(fields[statPPIDIndex])
+	if err != nil {
+		return processStat{}, fmt.Errorf("invalid ppid: %v", err)
+	}
+
+	var values []uint64
+	for _, idx := range []int{statUTimeIndex, statSTimeIndex, statRSSIndex} {
+		value, err := strconv.ParseUint(fields[idx], 10, 64)
+		if err != nil {
+			return processStat{}, fmt.Errorf("invalid stat field (%d): %v", idx, err)
+		}
+		values = append(values, value)
+	}
+
+	return processStat{
+		pid:      pid,
+		ppid:     ppid,
+		cpuTicks: values[0] + values[1],
+		rssBytes: values[2] * uint64(pageSize),
+	}, nil
+}
+
+func listProcesses(dir string) ([]processStat, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	pageSize := os.Getpagesize()
+	var processes []processStat
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+
+		// Processes might exit while we are iterating, these are simply skipped.
+		content, err := ioutil.ReadFile(filepath.Join(dir, entry.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		stat, err := parseProcessStat(string(content), pageSize)
+		if err != nil {
+			continue
+		}
+		if cmdline, err := ioutil.ReadFile(filepath.Join(dir, entry.Name(), "cmdline")); err == nil {
+			stat.cmdline = strings.Replace(string(cmdline), "\x00", " ", -1)
+		}
+
+		processes = append(processes, stat)
+	}
+	return processes, nil
+}
+
+// gradleProcessTree returns the descendants of the root (gradlew) process and the Gradle and Kotlin daemons.
+// The daemons are detached from the process started by the step, so they are matched by their command line.
+func gradleProcessTree(processes []processStat, rootPID int) []processStat {
+	children := map[int][]processStat{}
+	for _, p := range processes {
+		children[p.ppid] = append(children[p.ppid], p)
+	}
+
+	var tree []processStat
+	seen := map[int]bool{}
+	var walk func(p processStat)
+	walk = func(p processStat) {
+		if seen[p.pid] {
+			return
+		}
+		seen[p.pid] = true
+		tree = append(tree, p)
+		for _, child := range children[p.pid] {
+			walk(child)
+		}
+	}
+
+	for _, p := range processes {
+		if p.pid == rootPID || strings.Contains(p.cmdline, gradleDaemonMarker) || strings.Contains(p.cmdline, kotlinDaemonMarker) {
+			walk(p)
+		}
+	}
+
+	return tree
+}
+
+type resourceSampler struct {
+	dir     string
+	rootPID int
+
+	mu           sync.Mutex
+	samples      int
+	peakRSSBytes uint64
+	startTicks   map[int]uint64
+	lastTicks    map[int]uint64
+}
+
+func newResourceSampler(dir string, rootPID int) *resourceSampler {
+	return &resourceSampler{
+		dir:        dir,
+		rootPID:    rootPID,
+		startTicks: map[int]uint64{},
+		lastTicks:  map[int]uint64{},
+	}
+}
+
+func (s *resourceSampler) sample() {
+	processes, err := listProcesses(s.dir)
+	if err != nil {
+		logger.Debugf("Failed to list processes: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Daemons started by an earlier Gradle invocation are already running when the first sample is taken,
+	// only the CPU time spent after that is accounted to the build.
+	isFirst := s.samples == 0
+	var rss uint64
+	for _, p := range gradleProcessTree(processes, s.rootPID) {
+		rss += p.rssBytes
+		if _, ok := s.startTicks[p.pid]; !ok {
+			if isFirst {
+				s.startTicks[p.pid] = p.cpuTicks
+			} else {
+				s.startTicks[p.pid] = 0
+			}
+		}
+		s.lastTicks[p.pid] = p.cpuTicks
+	}
+
+	s.samples++
+	if rss > s.peakRSSBytes {
+		s.peakRSSBytes = rss
+	}
+}
+
+func (s *resourceSampler) metrics(duration time.Duration) BuildMetrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ticks uint64
+	for pid, last := range s.lastTicks {
+		if start := s.startTicks[pid]; last > start {
+			ticks += last - start
+		}
+	}
+
+	return BuildMetrics{
+		DurationSeconds: duration.Seconds(),
+		PeakRSSBytes:    s.peakRSSBytes,
+		CPUTimeSeconds:  float64(ticks) / clockTicksPerSecond,
+		Samples:         s.samples,
+	}
+}
+
+// runWithMetrics runs the given command and samples the resource usage of the Gradle process tree
+// while it is running. Sampling is only available on Linux, elsewhere only the duration is measured.
+func runWithMetrics(cmd command.Command) (BuildMetrics, error) {
+	started := time.Now()
+
+	execCmd, ok := cmd.(interface{ GetCmd() *exec.Cmd })
+	procAvailable := false
+	if _, err := os.Stat(filepath.Join(procDir, "self", "stat")); err == nil {
+		procAvailable = true
+	}
+	if !ok || !procAvailable {
+		logger.Debugf("Resource usage sampling is not available")
+		err := cmd.Run()
+		return BuildMetrics{DurationSeconds: time.Since(started).Seconds()}, err
+	}
+
+	if err := execCmd.GetCmd().Start(); err != nil {
+		return BuildMetrics{}, err
+	}
+
+	sampler := newResourceSampler(procDir, execCmd.GetCmd().Process.Pid)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(sampleInterval)
+		defer ticker.Stop()
+
+		sampler.sample()
+		for {
+			select {
+			case <-ticker.C:
+				sampler.sample()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := execCmd.GetCmd().Wait()
+	close(done)
+	wg.Wait()
+
+	return sampler.metrics(time.Since(started)), err
+}
+
+func printBuildMetrics(metrics BuildMetrics) {
+	logger.Printf("  Duration:   %s", (time.Duration(metrics.DurationSeconds * float64(time.Second))).Round(time.Second))
+	if metrics.Samples == 0 {
+		return
+	}
+	logger.Printf("  Peak RSS:   %.1f MB", float64(metrics.PeakRSSBytes)/1024/1024)
+	logger.Printf("  CPU time:   %.1f s", metrics.CPUTimeSeconds)
+}
+
+func exportBuildMetrics(metrics BuildMetrics, deployDir string) (string, error) {
+	pth := filepath.Join(deployDir, buildMetricsFileName)
+	if err := fileutil.WriteJSONToFile(pth, metrics); err != nil {
+		return "", fmt.Errorf("failed to write build metrics: %v", err)
+	}
+	return pth, nil
+}
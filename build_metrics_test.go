@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseProcessStat(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    processStat
+		wantErr bool
+	}{
+		{
+			name:    "java process",
+			content: "4242 (java) S 4200 4242 4200 0 -1 1077936128 1000 0 0 0 1500 300 0 0 20 0 52 0 1234 5678901234 1000 18446744073709551615",
+			want:    processStat{pid: 4242, ppid: 4200, cpuTicks: 1800, rssBytes: 4096000},
+		},
+		{
+			name:    "command name with spaces and parentheses",
+			content: "12 (my (weird) cmd) R 1 12 12 0 -1 4194304 10 0 0 0 7 3 0 0 20 0 1 0 100 1000 2 18446744073709551615",
+			want:    processStat{pid: 12, ppid: 1, cpuTicks: 10, rssBytes: 8192},
+		},
+		{
+			name:    "truncated content",
+			content: "12 (java) R 1 12",
+			wantErr: true,
+		},
+		{
+			name:    "missing command name",
+			content: "12 java R 1 12 12 0 -1 4194304 10 0 0 0 7 3 0 0 20 0 1 0 100 1000 2",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseProcessStat(tt.content, 4096)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseProcessStat() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseProcessStat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_gradleProcessTree(t *testing.T) {
+	processes := []processStat{
+		{pid: 1, ppid: 0, cmdline: "/sbin/init"},
+		{pid: 10, ppid: 1, cmdline: "bash"},
+		{pid: 20, ppid: 10, cmdline: "/bin/sh ./gradlew assembleDemoDebug"},
+		{pid: 21, ppid: 20, cmdline: "java org.gradle.wrapper.GradleWrapperMain assembleDemoDebug"},
+		{pid: 30, ppid: 1, cmdline: "java -Xmx2g org.gradle.launcher.daemon.bootstrap.GradleDaemon 8.2"},
+		{pid: 31, ppid: 30, cmdline: "aapt2 daemon"},
+		{pid: 40, ppid: 1, cmdline: "java org.jetbrains.kotlin.daemon.KotlinCompileDaemon --daemon-runFilesPath"},
+		{pid: 50, ppid: 1, cmdline: "emulator -avd test"},
+	}
+
+	var got []int
+	for _, p := range gradleProcessTree(processes, 20) {
+		got = append(got, p.pid)
+	}
+
+	want := []int{20, 21, 30, 31, 40}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("gradleProcessTree() = %v, want %v", got, want)
+	}
+}
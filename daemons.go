@@ -0,0 +1,26 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/bitrise-io/go-utils/command"
+)
+
+const kotlinDaemonMarker = "org.jetbrains.kotlin.daemon.KotlinCompileDaemon"
+
+// stopGradleDaemons stops the Gradle daemons started by the project's Gradle wrapper and the Kotlin compile daemons,
+// so that the memory they hold is available for the subsequent (emulator, test) steps.
+func stopGradleDaemons(projectLocation string) {
+	stopCmd := cmdFactory.Create(filepath.Join(projectLocation, "gradlew"), []string{"--stop"}, &command.Opts{Dir: projectLocation})
+	logger.Donef("$ %s", stopCmd.PrintableCommandArgs())
+	if out, err := stopCmd.RunAndReturnTrimmedCombinedOutput(); err != nil {
+		logger.Warnf("Failed to stop Gradle daemons: %s, %v", out, err)
+	}
+
+	killCmd := cmdFactory.Create("pkill", []string{"-f", kotlinDaemonMarker}, nil)
+	logger.Donef("$ %s", killCmd.PrintableCommandArgs())
+	// pkill exits with 1 if no process matched
+	if exitCode, err := killCmd.RunAndReturnExitCode(); err != nil && exitCode != 1 {
+		logger.Warnf("Failed to stop Kotlin compile daemons: %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	flankConfigEnvKey   = "BITRISE_FLANK_CONFIG_PATH"
+	flankConfigFileName = "flank.yml"
+)
+
+// flankDeviceMinAPILevels are the lowest API levels of the Firebase Test Lab device models,
+// the default device versions are raised to these.
+var flankDeviceMinAPILevels = map[string]int{
+	"MediumPhone.arm": 26,
+}
+
+// flankConfig holds the values of the generated Flank configuration, see: https://flank.github.io/flank/
+type flankConfig struct {
+	AppAPK          string
+	TestAPK         string
+	TestRunnerClass string
+	TestTargets     []string
+	DeviceModel     string
+	DeviceVersions  []string
+	MaxTestShards   int
+}
+
+func newFlankConfig(appPth, testPth string, info testPackageInfo, app appInfo, model string, apiLevels, testTargets []string, maxTestShards int) flankConfig {
+	var versions []string
+	for _, level := range apiLevels {
+		if level = strings.TrimSpace(level); level != "" {
+			versions = append(versions, level)
+		}
+	}
+	if len(versions) == 0 {
+		versions = defaultDeviceVersions(app, model)
+	}
+
+	var targets []string
+	for _, target := range testTargets {
+		if target = strings.TrimSpace(target); target != "" {
+			targets = append(targets, target)
+		}
+	}
+
+	if maxTestShards < 1 {
+		maxTestShards = 1
+	}
+
+	return flankConfig{
+		AppAPK:          appPth,
+		TestAPK:         testPth,
+		TestRunnerClass: info.InstrumentationRunner,
+		TestTargets:     targets,
+		DeviceModel:     model,
+		DeviceVersions:  versions,
+		MaxTestShards:   maxTestShards,
+	}
+}
+
+// defaultDeviceVersions returns the oldest and the newest platform version the app supports,
+// not lower than the lowest API level of the device model (if known).
+func defaultDeviceVersions(app appInfo, model string) []string {
+	var versions []string
+	for _, version := range []string{app.MinSDKVersion, app.TargetSDKVersion} {
+		if minLevel, ok := flankDeviceMinAPILevels[model]; ok {
+			if level, err := strconv.Atoi(version); err == nil && level < minLevel {
+				logger.Warnf("The %s device model does not support API level %d, using %d", model, level, minLevel)
+				version = strconv.Itoa(minLevel)
+			}
+		}
+		if len(versions) == 0 || versions[0] != version {
+			versions = append(versions, version)
+		}
+	}
+	return versions
+}
+
+// yaml renders the Flank configuration. The strings are written as double-quoted YAML scalars,
+// which share the escaping rules of Go quoted strings for the characters used in paths and class names.
+func (c flankConfig) yaml() string {
+	var b strings.Builder
+	b.WriteString("gcloud:\n")
+	fmt.Fprintf(&b, "  app: %s\n", strconv.Quote(c.AppAPK))
+	fmt.Fprintf(&b, "  test: %s\n", strconv.Quote(c.TestAPK))
+	fmt.Fprintf(&b, "  test-runner-class: %s\n", strconv.Quote(c.TestRunnerClass))
+	if len(c.TestTargets) > 0 {
+		b.WriteString("  test-targets:\n")
+		for _, target := range c.TestTargets {
+			fmt.Fprintf(&b, "    - %s\n", strconv.Quote(target))
+		}
+	}
+	b.WriteString("  device:\n")
+	for _, version := range c.DeviceVersions {
+		fmt.Fprintf(&b, "    - model: %s\n", strconv.Quote(c.DeviceModel))
+		fmt.Fprintf(&b, "      version: %s\n", strconv.Quote(version))
+	}
+	b.WriteString("flank:\n")
+	fmt.Fprintf(&b, "  max-test-shards: %d\n", c.MaxTestShards)
+	return b.String()
+}
+
+// exportFlankConfig writes the flank.yml into the deploy dir.
+func exportFlankConfig(config flankConfig, deployDir, collisionPolicy string) (string, error) {
+	return writeDeployFile(deployDir, flankConfigFileName, []byte(config.yaml()), collisionPolicy)
+}
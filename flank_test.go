@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_flankConfig_yaml(t *testing.T) {
+	config := newFlankConfig(
+		"/deploy/app-debug.apk",
+		"/deploy/app-debug-androidTest.apk",
+		testPackageInfo{InstrumentationRunner: "androidx.test.runner.AndroidJUnitRunner"},
+		appInfo{MinSDKVersion: "26", TargetSDKVersion: "34"},
+		"MediumPhone.arm",
+		nil,
+		[]string{"class com.example.LoginTest", "", "  package com.example.smoke "},
+		4,
+	)
+
+	want := `gcloud:
+  app: "/deploy/app-debug.apk"
+  test: "/deploy/app-debug-androidTest.apk"
+  test-runner-class: "androidx.test.runner.AndroidJUnitRunner"
+  test-targets:
+    - "class com.example.LoginTest"
+    - "package com.example.smoke"
+  device:
+    - model: "MediumPhone.arm"
+      version: "26"
+    - model: "MediumPhone.arm"
+      version: "34"
+flank:
+  max-test-shards: 4
+`
+	if got := config.yaml(); got != want {
+		t.Errorf("yaml() = %s, want %s", got, want)
+	}
+}
+
+func Test_newFlankConfig_sameSDKVersions(t *testing.T) {
+	config := newFlankConfig("app.apk", "test.apk", testPackageInfo{}, appInfo{MinSDKVersion: "30", TargetSDKVersion: "30"}, "MediumPhone.arm", nil, nil, 1)
+	if len(config.DeviceVersions) != 1 || config.DeviceVersions[0] != "30" {
+		t.Errorf("newFlankConfig() device versions = %v, want [30]", config.DeviceVersions)
+	}
+	if len(config.TestTargets) != 0 {
+		t.Errorf("newFlankConfig() test targets = %v, want none", config.TestTargets)
+	}
+}
+
+func Test_newFlankConfig_deviceVersions(t *testing.T) {
+	tests := []struct {
+		name      string
+		app       appInfo
+		model     string
+		apiLevels []string
+		want      []string
+	}{
+		{name: "min and target SDK", app: appInfo{MinSDKVersion: "28", TargetSDKVersion: "34"}, model: "MediumPhone.arm", want: []string{"28", "34"}},
+		{name: "raised to the model's lowest level", app: appInfo{MinSDKVersion: "21", TargetSDKVersion: "34"}, model: "MediumPhone.arm", want: []string{"26", "34"}},
+		{name: "both raised", app: appInfo{MinSDKVersion: "21", TargetSDKVersion: "25"}, model: "MediumPhone.arm", want: []string{"26"}},
+		{name: "unknown model", app: appInfo{MinSDKVersion: "21", TargetSDKVersion: "34"}, model: "oriole", want: []string{"21", "34"}},
+		{name: "API levels input", app: appInfo{MinSDKVersion: "21", TargetSDKVersion: "34"}, model: "MediumPhone.arm", apiLevels: []string{"30", " ", "33 "}, want: []string{"30", "33"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newFlankConfig("app.apk", "test.apk", testPackageInfo{}, tt.app, tt.model, tt.apiLevels, nil, 1)
+			if !reflect.DeepEqual(config.DeviceVersions, tt.want) {
+				t.Errorf("newFlankConfig() device versions = %v, want %v", config.DeviceVersions, tt.want)
+			}
+		})
+	}
+}
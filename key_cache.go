@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-steputils/tools"
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+const (
+	cacheModeBranch = "branch"
+	cacheModeKey    = "key"
+
+	cacheKeyEnvKey             = "BITRISE_GRADLE_CACHE_KEY"
+	cachePathsEnvKey           = "BITRISE_GRADLE_CACHE_PATHS"
+	cacheRestoreManifestEnvKey = "BITRISE_GRADLE_CACHE_RESTORE_MANIFEST_PATH"
+	cacheSaveManifestEnvKey    = "BITRISE_GRADLE_CACHE_SAVE_MANIFEST_PATH"
+
+	cacheRestoreManifestFileName = "gradle-cache-restore.json"
+	cacheSaveManifestFileName    = "gradle-cache-save.json"
+
+	dependencyCacheName    = "gradle-dependencies"
+	wrapperCacheName       = "gradle-wrapper"
+	configurationCacheName = "gradle-configuration-cache"
+	buildOutputsCacheName  = "gradle-test-variant-outputs"
+
+	gradleWrapperPropertiesName = "gradle-wrapper.properties"
+	versionCatalogSuffix        = ".versions.toml"
+)
+
+// cacheEntry is a cache archive, identified by its key.
+// The restore keys are the prefixes of the key, the latest cache saved with a matching key is restored
+// if there is no exact match.
+type cacheEntry struct {
+	Name        string      `json:"name"`
+	Key         string      `json:"key"`
+	RestoreKeys []string    `json:"restore_keys,omitempty"`
+	Paths       []cachePath `json:"paths,omitempty"`
+}
+
+type cachePath struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// isCacheKeyInput checks if the file is used to compute the cache key: the wrapper properties,
+// the (settings) build scripts and the version catalogs.
+func isCacheKeyInput(name string) bool {
+	return name == gradleWrapperPropertiesName ||
+		strings.HasSuffix(name, ".gradle") ||
+		strings.HasSuffix(name, ".gradle.kts") ||
+		strings.HasSuffix(name, versionCatalogSuffix)
+}
+
+// cacheKeyChecksums returns the checksum of all the cache key inputs of the project and the checksum of the wrapper properties.
+// The checksums cover the paths relative to the project and the contents of the files, in a stable order.
+func cacheKeyChecksums(projectLocation string) (string, string, error) {
+	var inputs []string
+	if err := filepath.Walk(projectLocation, func(pth string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			// The build outputs, the hidden directories (.git, .gradle) and the JS dependencies do not hold the project's build files.
+			if pth != projectLocation && (info.Name() == "node_modules" || info.Name() == "build" || strings.HasPrefix(info.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isCacheKeyInput(info.Name()) {
+			inputs = append(inputs, pth)
+		}
+		return nil
+	}); err != nil {
+		return "", "", err
+	}
+	sort.Strings(inputs)
+
+	all := sha256.New()
+	wrapper := sha256.New()
+	for _, pth := range inputs {
+		rel, err := filepath.Rel(projectLocation, pth)
+		if err != nil {
+			return "", "", err
+		}
+		hash, err := fileSHA256(pth)
+		if err != nil {
+			return "", "", err
+		}
+
+		line := filepath.ToSlash(rel) + " " + hash + "\n"
+		if _, err := io.WriteString(all, line); err != nil {
+			return "", "", err
+		}
+		if filepath.Base(pth) == gradleWrapperPropertiesName {
+			if _, err := io.WriteString(wrapper, line); err != nil {
+				return "", "", err
+			}
+		}
+	}
+	return fmt.Sprintf("%x", all.Sum(nil)), fmt.Sprintf("%x", wrapper.Sum(nil)), nil
+}
+
+// cacheEntries returns the key-based cache archives of the dependencies, the wrapper distributions, the configuration cache
+// and the build output dirs (if any). The keys are bound to the OS and the architecture, except the wrapper distributions' key.
+// The build outputs are keyed by the source revision too, the latest outputs of the same build files are restored
+// if there is no exact match.
+func cacheEntries(projectLocation, homeDir, gradleHome, checksum, wrapperChecksum, revision string, outputDirs []string) []cacheEntry {
+	platform := runtime.GOOS + "-" + runtime.GOARCH
+	entry := func(name, prefix, checksum string, paths ...string) cacheEntry {
+		e := cacheEntry{Name: name, Key: prefix + checksum, RestoreKeys: []string{prefix}}
+		for _, pth := range paths {
+			e.Paths = append(e.Paths, cachePath{Path: pth})
+		}
+		return e
+	}
+	entries := []cacheEntry{
+		entry(dependencyCacheName, dependencyCacheName+"-"+platform+"-", checksum,
+			filepath.Join(gradleHome, "caches"),
+			filepath.Join(homeDir, ".m2", "repository")),
+		entry(wrapperCacheName, wrapperCacheName+"-", wrapperChecksum,
+			filepath.Join(gradleHome, "wrapper", "dists")),
+		entry(configurationCacheName, configurationCacheName+"-"+platform+"-", checksum,
+			filepath.Join(projectLocation, ".gradle", "configuration-cache")),
+	}
+	if len(outputDirs) > 0 {
+		prefix := buildOutputsCacheName + "-" + platform + "-" + checksum + "-"
+		entries = append(entries, entry(buildOutputsCacheName, prefix, strings.Replace(revision, ":", "-", 1), outputDirs...))
+	}
+	return entries
+}
+
+// pathSize returns the size of the files under the path, the size of a missing path is 0.
+func pathSize(pth string) (int64, error) {
+	var size int64
+	err := filepath.Walk(pth, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// exportCacheManifests writes the restore manifest (the keys) and the save manifest (the keys and the paths with their sizes).
+func exportCacheManifests(entries []cacheEntry, deployDir string) (string, string, error) {
+	var restore []cacheEntry
+	for _, entry := range entries {
+		restore = append(restore, cacheEntry{Name: entry.Name, Key: entry.Key, RestoreKeys: entry.RestoreKeys})
+	}
+
+	restorePth := filepath.Join(deployDir, cacheRestoreManifestFileName)
+	savePth := filepath.Join(deployDir, cacheSaveManifestFileName)
+	for _, manifest := range []struct {
+		pth     string
+		entries []cacheEntry
+	}{
+		{restorePth, restore},
+		{savePth, entries},
+	} {
+		content, err := json.MarshalIndent(manifest.entries, "", "  ")
+		if err != nil {
+			return "", "", err
+		}
+		if err := ioutil.WriteFile(manifest.pth, content, 0644); err != nil {
+			return "", "", err
+		}
+	}
+	return restorePth, savePth, nil
+}
+
+// collectKeyBasedCache computes the cache keys, reports the size of the cached paths and exports the cache manifests.
+// Replaces the branch-based cache path collection, the Restore Cache and Save Cache steps can use the exported
+// key and paths, or the manifests.
+func collectKeyBasedCache(projectLocation, deployDir string, outputDirs []string) error {
+	checksum, wrapperChecksum, err := cacheKeyChecksums(projectLocation)
+	if err != nil {
+		return fmt.Errorf("failed to compute the cache key: %v", err)
+	}
+
+	var revision string
+	if len(outputDirs) > 0 {
+		if revision, err = sourceRevision(projectLocation); err != nil {
+			return fmt.Errorf("failed to compute the source revision: %v", err)
+		}
+	}
+
+	entries := cacheEntries(projectLocation, pathutil.UserHomeDir(), gradleUserHome(), checksum, wrapperChecksum, revision, outputDirs)
+	var paths []string
+	for i, entry := range entries {
+		logger.Printf("  %s", entry.Key)
+		for j, p := range entry.Paths {
+			size, err := pathSize(p.Path)
+			if err != nil {
+				return fmt.Errorf("failed to compute the size of %s: %v", p.Path, err)
+			}
+			entries[i].Paths[j].Size = size
+			paths = append(paths, p.Path)
+			logger.Printf("    %s (%s)", p.Path, formatSize(uint64(size)))
+		}
+	}
+
+	restorePth, savePth, err := exportCacheManifests(entries, deployDir)
+	if err != nil {
+		return fmt.Errorf("failed to write the cache manifests: %v", err)
+	}
+
+	for _, env := range [][2]string{
+		{cacheKeyEnvKey, entries[0].Key},
+		{cachePathsEnvKey, strings.Join(paths, "\n")},
+		{cacheRestoreManifestEnvKey, restorePth},
+		{cacheSaveManifestEnvKey, savePth},
+	} {
+		if err := tools.ExportEnvironmentWithEnvman(env[0], env[1]); err != nil {
+			return fmt.Errorf("failed to export environment variable: %s", env[0])
+		}
+	}
+	logger.Printf("  Env    [ $%s = %s ]", cacheKeyEnvKey, entries[0].Key)
+	logger.Printf("  Env    [ $%s = $BITRISE_DEPLOY_DIR/%s ]", cacheRestoreManifestEnvKey, filepath.Base(restorePth))
+	logger.Printf("  Env    [ $%s = $BITRISE_DEPLOY_DIR/%s ]", cacheSaveManifestEnvKey, filepath.Base(savePth))
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func Test_cacheKeyChecksums(t *testing.T) {
+	project := t.TempDir()
+	writeTestFile(t, filepath.Join(project, "gradle", "wrapper", "gradle-wrapper.properties"), "distributionUrl=gradle-8.7-bin.zip")
+	writeTestFile(t, filepath.Join(project, "gradle", "libs.versions.toml"), "[versions]\nagp = \"8.4.0\"")
+	writeTestFile(t, filepath.Join(project, "settings.gradle.kts"), `include(":app")`)
+	buildFile := writeTestFile(t, filepath.Join(project, "app", "build.gradle"), "apply plugin: 'com.android.application'")
+
+	checksum, wrapperChecksum, err := cacheKeyChecksums(project)
+	if err != nil {
+		t.Fatalf("cacheKeyChecksums() error = %v", err)
+	}
+
+	// Files which are not cache key inputs, or are in skipped directories, do not change the checksums.
+	writeTestFile(t, filepath.Join(project, "app", "src", "main", "AndroidManifest.xml"), "<manifest/>")
+	writeTestFile(t, filepath.Join(project, "node_modules", "lib", "android", "build.gradle"), "")
+	writeTestFile(t, filepath.Join(project, "app", "build", "tmp", "generated.gradle"), "")
+	if got, gotWrapper, _ := cacheKeyChecksums(project); got != checksum || gotWrapper != wrapperChecksum {
+		t.Errorf("cacheKeyChecksums() = %s, %s, want unchanged %s, %s", got, gotWrapper, checksum, wrapperChecksum)
+	}
+
+	// A build file change only changes the checksum of all the inputs.
+	writeTestFile(t, buildFile, "plugins { id 'com.android.application' }")
+	got, gotWrapper, err := cacheKeyChecksums(project)
+	if err != nil {
+		t.Fatalf("cacheKeyChecksums() error = %v", err)
+	}
+	if got == checksum {
+		t.Errorf("cacheKeyChecksums() checksum did not change after the build file changed")
+	}
+	if gotWrapper != wrapperChecksum {
+		t.Errorf("cacheKeyChecksums() wrapper checksum = %s, want unchanged %s", gotWrapper, wrapperChecksum)
+	}
+}
+
+func Test_cacheEntries(t *testing.T) {
+	platform := runtime.GOOS + "-" + runtime.GOARCH
+	got := cacheEntries("/project", "/home", "/gradle-home", "abc", "def", "git:123", []string{"/project/.gradle/8.7", "/project/app/build/intermediates/javac/debug"})
+
+	want := []cacheEntry{
+		{
+			Name:        dependencyCacheName,
+			Key:         "gradle-dependencies-" + platform + "-abc",
+			RestoreKeys: []string{"gradle-dependencies-" + platform + "-"},
+			Paths:       []cachePath{{Path: "/gradle-home/caches"}, {Path: "/home/.m2/repository"}},
+		},
+		{
+			Name:        wrapperCacheName,
+			Key:         "gradle-wrapper-def",
+			RestoreKeys: []string{"gradle-wrapper-"},
+			Paths:       []cachePath{{Path: "/gradle-home/wrapper/dists"}},
+		},
+		{
+			Name:        configurationCacheName,
+			Key:         "gradle-configuration-cache-" + platform + "-abc",
+			RestoreKeys: []string{"gradle-configuration-cache-" + platform + "-"},
+			Paths:       []cachePath{{Path: "/project/.gradle/configuration-cache"}},
+		},
+		{
+			Name:        buildOutputsCacheName,
+			Key:         "gradle-test-variant-outputs-" + platform + "-abc-git-123",
+			RestoreKeys: []string{"gradle-test-variant-outputs-" + platform + "-abc-"},
+			Paths:       []cachePath{{Path: "/project/.gradle/8.7"}, {Path: "/project/app/build/intermediates/javac/debug"}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cacheEntries() = %v, want %v", got, want)
+	}
+}
+
+func Test_pathSize(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a", "file"), "1234")
+	writeTestFile(t, filepath.Join(dir, "b", "c", "file"), "123456")
+
+	tests := []struct {
+		pth  string
+		want int64
+	}{
+		{pth: dir, want: 10},
+		{pth: filepath.Join(dir, "a", "file"), want: 4},
+		{pth: filepath.Join(dir, "missing"), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pth, func(t *testing.T) {
+			got, err := pathSize(tt.pth)
+			if err != nil {
+				t.Fatalf("pathSize() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("pathSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_exportCacheManifests(t *testing.T) {
+	entries := []cacheEntry{{
+		Name:        wrapperCacheName,
+		Key:         "gradle-wrapper-def",
+		RestoreKeys: []string{"gradle-wrapper-"},
+		Paths:       []cachePath{{Path: "/home/.gradle/wrapper/dists", Size: 42}},
+	}}
+
+	restorePth, savePth, err := exportCacheManifests(entries, t.TempDir())
+	if err != nil {
+		t.Fatalf("exportCacheManifests() error = %v", err)
+	}
+
+	for _, tt := range []struct {
+		pth  string
+		want []cacheEntry
+	}{
+		{pth: restorePth, want: []cacheEntry{{Name: wrapperCacheName, Key: "gradle-wrapper-def", RestoreKeys: []string{"gradle-wrapper-"}}}},
+		{pth: savePth, want: entries},
+	} {
+		content, err := ioutil.ReadFile(tt.pth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []cacheEntry
+		if err := json.Unmarshal(content, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("exportCacheManifests() %s = %v, want %v", filepath.Base(tt.pth), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	"github.com/bitrise-io/go-android/gradle"
+	"github.com/bitrise-steplib/bitrise-step-android-build-for-ui-testing/apk"
+)
+
+const (
+	moduleTypeAuto        = "auto"
+	moduleTypeApplication = "application"
+	moduleTypeLibrary     = "library"
+	moduleTypeBenchmark   = "benchmark"
+)
+
+// libraryPluginRegexp matches the Android library plugin applied in a build file, like:
+//
+//	apply plugin: 'com.android.library'
+//	id("com.android.library")
+//	alias(libs.plugins.android.library)
+var libraryPluginRegexp = regexp.MustCompile(`com\.android\.library|libs\.plugins\.android\.library\b`)
+
+// isLibraryModule checks if the build file of the module applies the Android library plugin, commented-out lines are ignored.
+func isLibraryModule(buildFileContent string) bool {
+	return libraryPluginRegexp.MatchString(stripComments(buildFileContent))
+}
+
+// resolveModuleType returns the configured module type, or detects it from the build file of the module.
+func resolveModuleType(moduleType, projectLocation, module string) (string, error) {
+	if moduleType != moduleTypeAuto {
+		return moduleType, nil
+	}
+
+	buildFile, err := moduleBuildFile(projectLocation, module)
+	if err != nil {
+		return "", err
+	}
+	content, err := ioutil.ReadFile(buildFile)
+	if err != nil {
+		return "", err
+	}
+	if isLibraryModule(string(content)) {
+		return moduleTypeLibrary, nil
+	}
+	if isBenchmarkModule(string(content)) {
+		return moduleTypeBenchmark, nil
+	}
+	return moduleTypeApplication, nil
+}
+
+// testVariantsOnly keeps the AndroidTest variant of the module, library modules do not produce an app APK.
+func testVariantsOnly(module string, variants gradle.Variants) gradle.Variants {
+	filtered := gradle.Variants{}
+	for _, variant := range variants[module] {
+		if isTestVariant(variant) {
+			filtered[module] = append(filtered[module], variant)
+		}
+	}
+	return filtered
+}
+
+// selfInstrumentingTestPackage checks that the test APK of a library module instruments itself.
+func selfInstrumentingTestPackage(testManifest apk.Manifest) (testPackageInfo, error) {
+	for _, instrumentation := range testManifest.Instrumentations {
+		if instrumentation.TargetPackage != testManifest.Package {
+			continue
+		}
+		return testPackageInfo{
+			AppPackage:            testManifest.Package,
+			TestPackage:           testManifest.Package,
+			InstrumentationRunner: instrumentation.Name,
+			TargetPackage:         instrumentation.TargetPackage,
+		}, nil
+	}
+
+	if len(testManifest.Instrumentations) == 0 {
+		return testPackageInfo{}, fmt.Errorf("the test APK (%s) does not declare an instrumentation", testManifest.Package)
+	}
+	return testPackageInfo{}, fmt.Errorf("the test APK's target package (%s) does not match its own package (%s)", testManifest.Instrumentations[0].TargetPackage, testManifest.Package)
+}
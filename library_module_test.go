@@ -0,0 +1,117 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bitrise-io/go-android/gradle"
+	"github.com/bitrise-steplib/bitrise-step-android-build-for-ui-testing/apk"
+)
+
+func Test_isLibraryModule(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{name: "groovy apply", content: "apply plugin: 'com.android.library'", want: true},
+		{name: "kotlin plugins block", content: `plugins { id("com.android.library") }`, want: true},
+		{name: "version catalog", content: "plugins { alias(libs.plugins.android.library) }", want: true},
+		{name: "application", content: `plugins { id("com.android.application") }`, want: false},
+		{name: "version catalog application", content: "plugins { alias(libs.plugins.android.application) }", want: false},
+		{name: "commented out", content: "plugins {\n    id(\"com.android.application\")\n    // id(\"com.android.library\")\n}", want: false},
+		{name: "block comment", content: "/* apply plugin: 'com.android.library' */\napply plugin: 'com.android.application'", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isLibraryModule(tt.content); got != tt.want {
+				t.Errorf("isLibraryModule() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_resolveModuleType(t *testing.T) {
+	project := t.TempDir()
+	writeTestFile(t, filepath.Join(project, "lib", "build.gradle.kts"), `plugins { id("com.android.library") }`)
+	writeTestFile(t, filepath.Join(project, "app", "build.gradle"), "apply plugin: 'com.android.application'")
+
+	tests := []struct {
+		moduleType string
+		module     string
+		want       string
+		wantErr    bool
+	}{
+		{moduleType: moduleTypeAuto, module: "lib", want: moduleTypeLibrary},
+		{moduleType: moduleTypeAuto, module: "app", want: moduleTypeApplication},
+		{moduleType: moduleTypeLibrary, module: "app", want: moduleTypeLibrary},
+		{moduleType: moduleTypeAuto, module: "missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.moduleType+" "+tt.module, func(t *testing.T) {
+			got, err := resolveModuleType(tt.moduleType, project, tt.module)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveModuleType() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveModuleType() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_testVariantsOnly(t *testing.T) {
+	got := testVariantsOnly("lib", gradle.Variants{"lib": {"debug", "debugAndroidTest"}})
+	if want := (gradle.Variants{"lib": {"debugAndroidTest"}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("testVariantsOnly() = %v, want %v", got, want)
+	}
+}
+
+func Test_selfInstrumentingTestPackage(t *testing.T) {
+	runner := "androidx.test.runner.AndroidJUnitRunner"
+	tests := []struct {
+		name     string
+		manifest apk.Manifest
+		want     testPackageInfo
+		wantErr  bool
+	}{
+		{
+			name: "instruments itself",
+			manifest: apk.Manifest{
+				Package:          "com.example.lib.test",
+				Instrumentations: []apk.Instrumentation{{Name: runner, TargetPackage: "com.example.lib.test"}},
+			},
+			want: testPackageInfo{
+				AppPackage:            "com.example.lib.test",
+				TestPackage:           "com.example.lib.test",
+				InstrumentationRunner: runner,
+				TargetPackage:         "com.example.lib.test",
+			},
+		},
+		{
+			name: "instruments an app",
+			manifest: apk.Manifest{
+				Package:          "com.example.test",
+				Instrumentations: []apk.Instrumentation{{Name: runner, TargetPackage: "com.example"}},
+			},
+			wantErr: true,
+		},
+		{
+			name:     "no instrumentation",
+			manifest: apk.Manifest{Package: "com.example.lib.test"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selfInstrumentingTestPackage(tt.manifest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("selfInstrumentingTestPackage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("selfInstrumentingTestPackage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strings"
 	"time"
 
@@ -17,65 +18,102 @@ import (
 	"github.com/bitrise-io/go-utils/command"
 	"github.com/bitrise-io/go-utils/env"
 	"github.com/bitrise-io/go-utils/log"
-	"github.com/bitrise-io/go-utils/pathutil"
 	"github.com/bitrise-io/go-utils/sliceutil"
+	"github.com/bitrise-steplib/bitrise-step-android-build-for-ui-testing/apk"
 	shellquote "github.com/kballard/go-shellquote"
 )
 
 const (
-	apkEnvKey     = "BITRISE_APK_PATH"
-	testApkEnvKey = "BITRISE_TEST_APK_PATH"
-	testSuffix    = "AndroidTest"
+	apkEnvKey         = "BITRISE_APK_PATH"
+	testApkEnvKey     = "BITRISE_TEST_APK_PATH"
+	apkListEnvKey     = "BITRISE_APK_PATH_LIST"
+	testApkListEnvKey = "BITRISE_TEST_APK_PATH_LIST"
+	testSuffix        = "AndroidTest"
 )
 
 // Configs ...
 type Configs struct {
-	ProjectLocation string `env:"project_location,dir"`
-	APKPathPattern  string `env:"apk_path_pattern"`
-	Variant         string `env:"variant,required"`
-	Module          string `env:"module,required"`
-	Arguments       string `env:"arguments"`
-	CacheLevel      string `env:"cache_level,opt[none,only_deps,all]"`
-	DeployDir       string `env:"BITRISE_DEPLOY_DIR,dir"`
+	ProjectLocation string   `env:"project_location,dir"`
+	APKPathPattern  []string `env:"apk_path_pattern,multiline"`
+	Variant         string   `env:"variant,required"`
+	Module          string   `env:"module,required"`
+	ModuleType      string   `env:"module_type,opt[auto,application,library,benchmark]"`
+	ABI             string   `env:"abi"`
+	Arguments       string   `env:"arguments"`
+	CacheLevel      string   `env:"cache_level,opt[none,only_deps,test_variants,all]"`
+	CacheMode       string   `env:"cache_mode,opt[branch,key]"`
+	StopDaemons     bool     `env:"stop_gradle_daemons,opt[true,false]"`
+	ReuseArtifacts  bool     `env:"reuse_artifacts,opt[true,false]"`
+	ReuseDir        string   `env:"artifact_reuse_dir"`
+
+	KeystorePath       string          `env:"keystore_path"`
+	KeystorePassword   stepconf.Secret `env:"keystore_password"`
+	KeystoreAlias      string          `env:"keystore_alias"`
+	PrivateKeyPassword stepconf.Secret `env:"private_key_password"`
+	SignerScheme       string          `env:"signer_scheme,opt[automatic,v1,v2,v3]"`
+	SignatureCheck     string          `env:"signature_check,opt[fail,warn]"`
+
+	CreateTestBundle bool `env:"create_test_bundle,opt[true,false]"`
+
+	MaxAPKSizeMB   int `env:"max_apk_size_mb"`
+	MaxMethodCount int `env:"max_method_count"`
+
+	SizeBaselinePath    string `env:"size_baseline_path"`
+	SizeDiffThresholdKB int    `env:"size_diff_threshold_kb"`
+
+	GenerateFlankConfig bool     `env:"generate_flank_config,opt[true,false]"`
+	FlankTestTargets    []string `env:"flank_test_targets,multiline"`
+	FlankDeviceModel    string   `env:"flank_device_model"`
+	FlankAPILevels      []string `env:"flank_device_api_levels,multiline"`
+	FlankMaxTestShards  int      `env:"flank_max_test_shards,range[1..50]"`
+
+	ArtifactSearchExclude   []string `env:"artifact_search_exclude,multiline"`
+	StrictArtifactFreshness bool     `env:"strict_artifact_freshness,opt[true,false]"`
+
+	ArtifactNameTemplate  string `env:"artifact_name_template"`
+	ArtifactNameCollision string `env:"artifact_name_collision,opt[timestamp,counter,overwrite,fail]"`
+
+	DeployDir string `env:"BITRISE_DEPLOY_DIR,dir"`
 }
 
 var cmdFactory = command.NewFactory(env.NewRepository())
 var logger = log.NewLogger(false)
 
-func getArtifacts(gradleProject gradle.Project, started time.Time, pattern string, includeModule bool) (artifacts []gradle.Artifact, err error) {
-	artifacts, err = gradleProject.FindArtifacts(started, pattern, includeModule)
+func getArtifacts(search artifactSearch, patterns pathPatterns) (artifacts []gradle.Artifact, err error) {
+	result, err := search.find(patterns)
 	if err != nil {
 		return
 	}
-	if len(artifacts) == 0 {
-		if !started.IsZero() {
-			logger.Warnf("No artifacts found with pattern: %s that has modification time after: %s", pattern, started)
-			logger.Warnf("Retrying without modtime check....")
-			fmt.Println()
-			return getArtifacts(gradleProject, time.Time{}, pattern, includeModule)
+	logger.Printf("Artifact search took %s (%d directories scanned)", result.Duration.Round(time.Millisecond), result.ScannedDirs)
+	for _, decision := range result.Decisions {
+		switch {
+		case decision.Selected:
+			logger.Printf("  Match   [ %s: %s ]", decision.Path, decision.Pattern)
+		case decision.Pattern != "":
+			logger.Printf("  Exclude [ %s: %s ]", decision.Path, decision.Pattern)
+		default:
+			logger.Printf("  Skip    [ %s: no include pattern matched ]", decision.Path)
 		}
-		logger.Warnf("No artifacts found with pattern: %s without modtime check", pattern)
+	}
+
+	artifacts = result.Artifacts
+	if len(artifacts) == 0 {
+		logger.Warnf("No artifacts found with patterns: %s", patterns)
 	}
 
 	return
 }
 
-func exportArtifacts(artifacts []gradle.Artifact, deployDir string) ([]string, error) {
+func exportArtifacts(artifacts []gradle.Artifact, deployDir, collisionPolicy string) ([]string, error) {
 	var paths []string
 	for _, artifact := range artifacts {
-		exists, err := pathutil.IsPathExists(filepath.Join(deployDir, artifact.Name))
+		name, err := resolveNameCollision(deployDir, artifact.Name, collisionPolicy)
 		if err != nil {
-			return nil, fmt.Errorf("failed to check path, error: %v", err)
+			return nil, err
 		}
 
 		artifactName := filepath.Base(artifact.Path)
-
-		if exists {
-			timestamp := time.Now().Format("20060102150405")
-			ext := filepath.Ext(artifact.Name)
-			name := strings.TrimSuffix(filepath.Base(artifact.Name), ext)
-			artifact.Name = fmt.Sprintf("%s-%s%s", name, timestamp, ext)
-		}
+		artifact.Name = name
 
 		logger.Printf("  Export [ %s => $BITRISE_DEPLOY_DIR/%s ]", artifactName, artifact.Name)
 
@@ -89,6 +127,21 @@ func exportArtifacts(artifacts []gradle.Artifact, deployDir string) ([]string, e
 	return paths, nil
 }
 
+// exportPathList exports the pipe (|) separated list of the exported artifact paths.
+func exportPathList(envKey string, pths []string) error {
+	if err := tools.ExportEnvironmentWithEnvman(envKey, strings.Join(pths, "|")); err != nil {
+		return fmt.Errorf("Failed to export environment variable: %s", envKey)
+	}
+
+	var paths, sep string
+	for _, path := range pths {
+		paths += sep + "$BITRISE_DEPLOY_DIR/" + filepath.Base(path)
+		sep = "| \\\n" + strings.Repeat(" ", 11)
+	}
+	logger.Printf("  Env    [ $%s = %s ]", envKey, paths)
+	return nil
+}
+
 func filterVariants(module, variant string, variantsMap gradle.Variants) (gradle.Variants, error) {
 	filteredVariants := gradle.Variants{}
 	var testVariant string
@@ -119,7 +172,7 @@ func androidTestVariantPairs(module string, variantsMap gradle.Variants) (gradle
 	testVariants := gradle.Variants{}
 	for m, variants := range variantsMap {
 		for _, v := range variants {
-			if strings.HasSuffix(strings.ToLower(v), strings.ToLower(testSuffix)) {
+			if isTestVariant(v) {
 				testVariants[m] = append(testVariants[m], v)
 			} else {
 				appVariants[m] = append(appVariants[m], v)
@@ -139,6 +192,10 @@ func androidTestVariantPairs(module string, variantsMap gradle.Variants) (gradle
 	return variantPairs, nil
 }
 
+func isTestVariant(variant string) bool {
+	return strings.HasSuffix(strings.ToLower(variant), strings.ToLower(testSuffix))
+}
+
 func isTestAPK(apkPath string) bool {
 	// Example names:
 	// app-debug-androidTest.apk
@@ -147,20 +204,55 @@ func isTestAPK(apkPath string) bool {
 	return testArtifactRegexp.MatchString(path.Base(apkPath))
 }
 
-func mainE(config Configs) error {
-	started := time.Now()
-
-	gradleProject, err := gradle.NewProject(config.ProjectLocation, cmdFactory)
+// findAPKs locates the app and test APKs of the selected variant, depending on the type of the module:
+// library modules have no app APK, the app APK of a benchmark module is built by the app module it targets.
+func findAPKs(config Configs, moduleType, targetModule string) (apkSet, error) {
+	apks, err := findModuleAPKs(config, config.Module)
 	if err != nil {
-		return fmt.Errorf("Failed to open project, error: %s", err)
+		return apkSet{}, err
 	}
 
-	buildTask := gradleProject.GetTask("assemble")
+	switch moduleType {
+	case moduleTypeLibrary:
+		apks.App = nil
+	case moduleTypeBenchmark:
+		appAPKs, err := findModuleAPKs(config, targetModule)
+		if err != nil {
+			return apkSet{}, err
+		}
+		for pth, filters := range appAPKs.Filters {
+			if apks.Filters == nil {
+				apks.Filters = map[string][]outputFilter{}
+			}
+			apks.Filters[pth] = filters
+		}
+		// The benchmark module builds the test APK with the variant itself, not with an AndroidTest variant.
+		apks.App, apks.Test = appAPKs.App, apks.App
+	}
+	return apks, nil
+}
 
-	args, err := shellquote.Split(config.Arguments)
+// findModuleAPKs locates the built APKs through the output metadata of the module,
+// or with the APK path pattern if the metadata is not available.
+func findModuleAPKs(config Configs, module string) (apkSet, error) {
+	apks, err := findOutputMetadataAPKs(moduleDir(config.ProjectLocation, module), config.Variant)
 	if err != nil {
-		return fmt.Errorf("Failed to parse arguments, error: %s", err)
+		logger.Warnf("Failed to read the output metadata: %v", err)
+	} else if !apks.empty() {
+		return apks, nil
+	}
+
+	patterns := parsePathPatterns(config.APKPathPattern)
+	logger.Printf("No %s found for the variant, searching with patterns: %s", outputMetadataFileName, patterns)
+	artifacts, err := getArtifacts(newArtifactSearch(config.ProjectLocation, []string{module}, config.ArtifactSearchExclude), patterns)
+	if err != nil {
+		return apkSet{}, err
 	}
+	return splitAPKsByName(artifacts), nil
+}
+
+func buildAPKs(config Configs, gradleProject gradle.Project, args []string, moduleType, targetModule string) (apkSet, BuildMetrics, string, error) {
+	buildTask := gradleProject.GetTask("assemble")
 
 	logger.Infof("Variants:")
 	logger.Printf("Reading Gradle project structure, this might take a while...")
@@ -168,15 +260,22 @@ func mainE(config Configs) error {
 
 	variants, err := buildTask.GetVariants(args...)
 	if err != nil {
-		return fmt.Errorf("Failed to fetch variants, error: %s", err)
+		return apkSet{}, BuildMetrics{}, "", fmt.Errorf("Failed to fetch variants, error: %s", err)
 	}
 
 	variantPairs, err := androidTestVariantPairs(config.Module, variants)
 	if err != nil {
-		return fmt.Errorf("Failed to find variant pairs (build and AndroidTest variant), error: %s", err)
+		return apkSet{}, BuildMetrics{}, "", fmt.Errorf("Failed to find variant pairs (build and AndroidTest variant), error: %s", err)
 	}
 
-	filteredVariants, err := filterVariants(config.Module, config.Variant, variants)
+	var filteredVariants gradle.Variants
+	if moduleType == moduleTypeBenchmark {
+		// The variants of a benchmark module are paired with the same variants of the app module, not by the AndroidTest suffix.
+		filteredVariants, err = benchmarkVariants(config.Module, targetModule, config.Variant, variants)
+		variantPairs = gradle.Variants{config.Module: variants[config.Module], targetModule: variants[targetModule]}
+	} else {
+		filteredVariants, err = filterVariants(config.Module, config.Variant, variants)
+	}
 	if err != nil {
 		// List all the variants if there is an error
 		for module, variants := range variants {
@@ -187,10 +286,13 @@ func mainE(config Configs) error {
 		}
 		fmt.Println()
 
-		return fmt.Errorf("Failed to find buildable variants, error: %s", err)
+		return apkSet{}, BuildMetrics{}, "", fmt.Errorf("Failed to find buildable variants, error: %s", err)
+	}
+	if moduleType == moduleTypeLibrary {
+		filteredVariants = testVariantsOnly(config.Module, filteredVariants)
 	}
 
-	// List the variants only which has (Build - AndroidTest) variant pair
+	// List the variants only which has (Build - AndroidTest) variant pair, or all the variants of the benchmark and the app module
 	for module, variants := range variantPairs {
 		logger.Printf("%s:", module)
 		for _, variant := range variants {
@@ -203,48 +305,201 @@ func mainE(config Configs) error {
 		fmt.Println()
 	}
 
+	logger.Infof("APKs found before the build:")
+	existingAPKs, err := findAPKs(config, moduleType, targetModule)
+	if err != nil {
+		return apkSet{}, BuildMetrics{}, "", fmt.Errorf("failed to find APKs: %v", err)
+	}
+	snapshot, err := takeArtifactSnapshot(existingAPKs.all())
+	if err != nil {
+		return apkSet{}, BuildMetrics{}, "", err
+	}
+	logger.Printf("%d APKs recorded in the snapshot", len(snapshot))
+	fmt.Println()
+
 	logger.Infof("Run build:")
 	buildCommand := buildTask.GetCommand(filteredVariants, args...)
 
 	logger.Donef("$ " + buildCommand.PrintableCommandArgs())
 	fmt.Println()
 
-	if err := buildCommand.Run(); err != nil {
-		return fmt.Errorf("Build task failed, error: %v", err)
+	buildMetrics, err := runWithMetrics(buildCommand)
+	if err != nil {
+		return apkSet{}, BuildMetrics{}, "", fmt.Errorf("Build task failed, error: %v", err)
 	}
 
+	fmt.Println()
+	logger.Infof("Build resource usage:")
+	printBuildMetrics(buildMetrics)
+
 	fmt.Println()
 
 	logger.Infof("APKs found after the build:")
-	apks, err := getArtifacts(gradleProject, started, config.APKPathPattern, false)
+	foundAPKs, err := findAPKs(config, moduleType, targetModule)
+	if err != nil {
+		return apkSet{}, BuildMetrics{}, "", fmt.Errorf("failed to find APKs: %v", err)
+	}
+
+	apks, states, err := snapshot.freshAPKs(foundAPKs, config.StrictArtifactFreshness)
+	for i, apk := range foundAPKs.all() {
+		logger.Printf("%d. %s (%s)", i+1, apk.Path, states[apk.Path])
+	}
+	if err != nil {
+		return apkSet{}, BuildMetrics{}, "", err
+	}
+
+	return apks, buildMetrics, buildCommand.PrintableCommandArgs(), nil
+}
+
+func mainE(config Configs) error {
+	if config.CacheMode == cacheModeKey && config.CacheLevel == string(utilscache.LevelAll) {
+		return fmt.Errorf("The %s cache level is not supported by the key-based cache, use %s or %s", utilscache.LevelAll, cacheLevelTestVariants, utilscache.LevelDeps)
+	}
+
+	gradleProject, err := gradle.NewProject(config.ProjectLocation, cmdFactory)
 	if err != nil {
-		return fmt.Errorf("failed to find APKs: %v", err)
+		return fmt.Errorf("Failed to open project, error: %s", err)
 	}
 
-	for i, apk := range apks {
-		logger.Printf("%d. %s", i+1, apk.Path)
+	args, err := shellquote.Split(config.Arguments)
+	if err != nil {
+		return fmt.Errorf("Failed to parse arguments, error: %s", err)
+	}
+
+	moduleType, err := resolveModuleType(config.ModuleType, config.ProjectLocation, config.Module)
+	if err != nil {
+		logger.Warnf("Failed to detect the module type: %v", err)
+		moduleType = moduleTypeApplication
+	}
+	library := moduleType == moduleTypeLibrary
+	if library {
+		logger.Printf("%s is a library module, only its test APK is built", config.Module)
+		fmt.Println()
+	}
+	var targetModule string
+	if moduleType == moduleTypeBenchmark {
+		if targetModule, err = benchmarkTargetModule(config.ProjectLocation, config.Module); err != nil {
+			return fmt.Errorf("Failed to find the app module of the benchmark module: %v", err)
+		}
+		logger.Printf("%s is a benchmark module, the %s variant of %s and %s is built", config.Module, config.Variant, config.Module, targetModule)
+		fmt.Println()
+	}
+
+	var reuseCache artifactCache
+	var reuseKey string
+	var apks apkSet
+	if config.ReuseArtifacts && library {
+		logger.Warnf("Artifact reuse is not supported for library modules")
+		fmt.Println()
+	} else if config.ReuseArtifacts {
+		if config.ReuseDir == "" {
+			return fmt.Errorf("Artifact reuse is enabled, but no artifact reuse directory is set")
+		}
+
+		logger.Infof("Artifact reuse:")
+		reuseCache = newArtifactCache(config.ReuseDir)
+		reuseKey, err = artifactReuseKey(config.ProjectLocation, config.Module, config.Variant, config.ABI, args)
+		if err != nil {
+			logger.Warnf("Failed to compute artifact reuse key: %v", err)
+		} else {
+			logger.Printf("Key: %s", reuseKey)
+			app, test, found, err := reuseCache.Lookup(reuseKey)
+			if err != nil {
+				logger.Warnf("Failed to look up reusable APKs: %v", err)
+			} else if found {
+				apks = apkSet{App: []gradle.Artifact{app}, Test: []gradle.Artifact{test}}
+				printReusedArtifacts(config.ReuseDir, apks.all())
+			} else {
+				logger.Printf("No reusable APKs found, building them")
+			}
+		}
+		fmt.Println()
+	}
+
+	var buildMetrics *BuildMetrics
+	var gradleCommand string
+	if apks.empty() {
+		// The daemons are stopped on the error returns too.
+		if config.StopDaemons {
+			defer func() {
+				fmt.Println()
+				logger.Infof("Stop Gradle daemons:")
+				stopGradleDaemons(config.ProjectLocation)
+			}()
+		}
+
+		builtAPKs, metrics, command, err := buildAPKs(config, gradleProject, args, moduleType, targetModule)
+		if err != nil {
+			return err
+		}
+		apks = builtAPKs
+		buildMetrics = &metrics
+		gradleCommand = command
 	}
 
 	fmt.Println()
 	logger.Infof("Export APKs:")
 	fmt.Println()
 
-	exportedArtifactPaths, err := exportArtifacts(apks, config.DeployDir)
-	if err != nil {
-		return fmt.Errorf("Failed to export artifact: %v", err)
+	apks.App = validateArtifacts(apks.App, false)
+	apks.Test = validateArtifacts(apks.Test, true)
+	var splitAPKs []gradle.Artifact
+	if len(apks.App) > 1 {
+		selected, err := selectAppAPK(apks, config.ABI)
+		if err != nil {
+			return fmt.Errorf("Failed to select the app APK: %v", err)
+		}
+		logger.Printf("  Split APKs: %s", splitList(apks, apks.App))
+		logger.Printf("  Selected:   %s", selected.Name)
+		fmt.Println()
+
+		for _, artifact := range apks.App {
+			if artifact.Path != selected.Path {
+				splitAPKs = append(splitAPKs, artifact)
+			}
+		}
+		apks.App = []gradle.Artifact{selected}
+	}
+
+	namer := &artifactNamer{Template: config.ArtifactNameTemplate, ProjectLocation: config.ProjectLocation, Module: config.Module, Variant: config.Variant}
+	var exportedAppPaths, exportedSplitPaths, exportedTestPaths []string
+	exports := []struct {
+		artifacts    []gradle.Artifact
+		artifactType string
+		exported     *[]string
+		named        []gradle.Artifact
+	}{
+		{artifacts: apks.App, artifactType: appArtifactType, exported: &exportedAppPaths},
+		{artifacts: splitAPKs, artifactType: splitArtifactType, exported: &exportedSplitPaths},
+		{artifacts: apks.Test, artifactType: testArtifactType, exported: &exportedTestPaths},
+	}
+	var original, named []gradle.Artifact
+	for i, export := range exports {
+		if exports[i].named, err = nameArtifacts(namer, apks, export.artifacts, export.artifactType); err != nil {
+			return fmt.Errorf("Failed to name the artifacts: %v", err)
+		}
+		original = append(original, export.artifacts...)
+		named = append(named, exports[i].named...)
+	}
+	if err := checkUniqueNames(original, named); err != nil {
+		return fmt.Errorf("Failed to name the artifacts: %v", err)
+	}
+	for _, export := range exports {
+		if *export.exported, err = exportArtifacts(export.named, config.DeployDir, config.ArtifactNameCollision); err != nil {
+			return fmt.Errorf("Failed to export artifact: %v", err)
+		}
 	}
 
 	var exportedAppArtifact string
 	var exportedTestArtifact string
-	for _, pth := range exportedArtifactPaths {
-		if isTestAPK(pth) {
-			exportedTestArtifact = pth
-		} else {
-			exportedAppArtifact = pth
-		}
+	if len(exportedAppPaths) > 0 {
+		exportedAppArtifact = exportedAppPaths[len(exportedAppPaths)-1]
+	}
+	if len(exportedTestPaths) > 0 {
+		exportedTestArtifact = exportedTestPaths[len(exportedTestPaths)-1]
 	}
 
-	if exportedAppArtifact == "" {
+	if exportedAppArtifact == "" && !library {
 		return fmt.Errorf("Could not find the exported app APK")
 	}
 
@@ -252,26 +507,319 @@ func mainE(config Configs) error {
 		return fmt.Errorf("Could not find the exported test APK")
 	}
 
+	// The APKs are stored for reuse before signing, the reuse key does not depend on the signing inputs.
+	if buildMetrics != nil && reuseKey != "" {
+		if err := reuseCache.Store(reuseKey, exportedAppArtifact, exportedTestArtifact); err != nil {
+			logger.Warnf("Failed to store APKs for reuse: %v", err)
+		} else {
+			logger.Printf("  Stored APKs for reuse in %s", config.ReuseDir)
+		}
+	}
+
+	if config.KeystorePath != "" {
+		fmt.Println()
+		logger.Infof("Sign APKs:")
+		signing := signingConfig{
+			KeystorePath:       config.KeystorePath,
+			KeystorePassword:   string(config.KeystorePassword),
+			Alias:              config.KeystoreAlias,
+			PrivateKeyPassword: string(config.PrivateKeyPassword),
+			Scheme:             config.SignerScheme,
+		}
+		// The split APKs and every listed test APK are signed as well, since they are exported too.
+		var signed []string
+		if !library {
+			signed = append(signed, exportedAppPaths...)
+			signed = append(signed, exportedSplitPaths...)
+		}
+		signed = append(signed, exportedTestPaths...)
+		if err := signArtifacts(signing, signed...); err != nil {
+			return fmt.Errorf("Failed to sign APKs: %v", err)
+		}
+	}
+
+	// The test APK of a library module instruments itself, there is no app APK to compare its signature with.
+	if !library {
+		fmt.Println()
+		logger.Infof("Signing certificates:")
+		signatures, err := checkSignatures(exportedAppArtifact, exportedTestArtifact)
+		if err == nil {
+			printSignatureComparison(signatures)
+			if !signatures.CertificatesMatch {
+				err = fmt.Errorf("the app and the test APKs are signed with different certificates, the test APK can not instrument the app")
+			}
+		}
+		if err != nil {
+			if config.SignatureCheck == signatureCheckFail {
+				return fmt.Errorf("Signing certificate check failed: %v", err)
+			}
+			logger.Warnf("Signing certificate check failed: %v", err)
+		} else {
+			logger.Donef("  The app and the test APKs are signed with the same certificate")
+		}
+	}
+
 	fmt.Println()
-	if err := tools.ExportEnvironmentWithEnvman(apkEnvKey, exportedAppArtifact); err != nil {
-		return fmt.Errorf("Failed to export environment variable: %s", apkEnvKey)
+	logger.Infof("Android Test Orchestrator:")
+	// The reused APKs skip Gradle, the Orchestrator APKs are only looked up in the local caches.
+	testUtilAPKs, err := findOrchestratorAPKs(config.ProjectLocation, config.Module, buildMetrics != nil)
+	if err != nil {
+		logger.Warnf("Failed to look up the Android Test Orchestrator APKs: %v", err)
+	}
+	exportedTestUtilAPKs := map[string]string{}
+	for _, testUtilAPK := range testUtilAPKs {
+		artifact := gradle.Artifact{Path: testUtilAPK.Location, Name: filepath.Base(testUtilAPK.Location)}
+		pths, err := exportArtifacts([]gradle.Artifact{artifact}, config.DeployDir, config.ArtifactNameCollision)
+		if err != nil {
+			return fmt.Errorf("Failed to export artifact: %v", err)
+		}
+		if len(pths) > 0 {
+			exportedTestUtilAPKs[testUtilAPK.EnvKey] = pths[0]
+		}
+	}
+
+	fmt.Println()
+	logger.Infof("Mapping files:")
+	var exportedMappingFiles map[string]string
+	if buildMetrics == nil {
+		// The mapping files in the build dir may belong to a different build than the reused APKs.
+		logger.Printf("  The APKs are reused, skipping the mapping files")
+	} else if exportedMappingFiles, err = exportMappingFiles(config.ProjectLocation, mappingVariants(config.Module, config.Variant, moduleType, targetModule), config.DeployDir, config.ArtifactNameCollision); err != nil {
+		logger.Warnf("Failed to export the mapping files: %v", err)
+	}
+
+	testManifest, err := apk.ReadManifest(exportedTestArtifact)
+	if err != nil {
+		return fmt.Errorf("Failed to read the test APK manifest: %v", err)
+	}
+
+	var packageInfo testPackageInfo
+	var app appInfo
+	if library {
+		fmt.Println()
+		logger.Infof("Test package:")
+		packageInfo, err = selfInstrumentingTestPackage(testManifest)
+		if err != nil {
+			return fmt.Errorf("Failed to match the test package: %v", err)
+		}
+		printTestPackageInfo(packageInfo)
+	} else {
+		appManifest, err := apk.ReadManifest(exportedAppArtifact)
+		if err != nil {
+			return fmt.Errorf("Failed to read the app APK manifest: %v", err)
+		}
+
+		fmt.Println()
+		logger.Infof("Test package:")
+		if moduleType == moduleTypeBenchmark {
+			packageInfo, err = matchBenchmarkPackage(appManifest, testManifest)
+		} else {
+			packageInfo, err = matchTestPackage(appManifest, testManifest)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to match the test package: %v", err)
+		}
+		printTestPackageInfo(packageInfo)
+
+		fmt.Println()
+		logger.Infof("App:")
+		nativeABIs, err := apk.NativeABIs(exportedAppArtifact)
+		if err != nil {
+			return fmt.Errorf("Failed to list the native ABIs of the app APK: %v", err)
+		}
+		app = newAppInfo(appManifest, nativeABIs, runtime.GOARCH)
+		printAppInfo(app)
+	}
+
+	fmt.Println()
+	logger.Infof("APK size:")
+	thresholds := sizeThresholds{MaxSizeMB: config.MaxAPKSizeMB, MaxMethodCount: config.MaxMethodCount}
+	if err := reportAPKSizes(config, thresholds, exportedAppArtifact, exportedTestArtifact); err != nil {
+		return err
+	}
+
+	var testBundlePath string
+	if config.CreateTestBundle {
+		fmt.Println()
+		logger.Infof("Test bundle:")
+		testBundlePath, err = createTestBundle(config, packageInfo, exportedAppArtifact, exportedTestArtifact, exportedTestUtilAPKs)
+		if err != nil {
+			return fmt.Errorf("Failed to create the test bundle: %v", err)
+		}
+	}
+
+	fmt.Println()
+	logger.Infof("Provenance:")
+	record := provenance{
+		StepVersion:   provenanceStepVersion(),
+		CreatedAt:     time.Now(),
+		Module:        config.Module,
+		Variant:       config.Variant,
+		GradleCommand: gradleCommand,
+		Reused:        buildMetrics == nil,
+		GitCommit:     gitCommit(config.ProjectLocation),
+	}
+	record.GradleVersion, record.AGPVersion, record.JDKVersion = readToolVersions(config.ProjectLocation)
+	var exportedAPKs [][2]string
+	if exportedAppArtifact != "" {
+		exportedAPKs = append(exportedAPKs, [2]string{exportedAppArtifact, testBundleRoleApp})
+	}
+	for _, pth := range exportedSplitPaths {
+		exportedAPKs = append(exportedAPKs, [2]string{pth, splitRole})
+	}
+	for _, pth := range exportedTestPaths {
+		exportedAPKs = append(exportedAPKs, [2]string{pth, testBundleRoleTest})
+	}
+	for _, testUtil := range [][2]string{{orchestratorAPKEnvKey, testBundleRoleOrchestrator}, {testServicesAPKEnvKey, testBundleRoleTestServices}} {
+		if pth, ok := exportedTestUtilAPKs[testUtil[0]]; ok {
+			exportedAPKs = append(exportedAPKs, [2]string{pth, testUtil[1]})
+		}
+	}
+	for _, exportedAPK := range exportedAPKs {
+		artifact, err := newProvenanceArtifact(exportedAPK[0], exportedAPK[1])
+		if err != nil {
+			return fmt.Errorf("Failed to compute the checksum of %s: %v", exportedAPK[0], err)
+		}
+		logger.Printf("  %s  %s", artifact.SHA256, artifact.Name)
+		record.Artifacts = append(record.Artifacts, artifact)
+	}
+	checksumsPath, provenancePath, err := exportProvenance(record, config.DeployDir, config.ArtifactNameCollision)
+	if err != nil {
+		return fmt.Errorf("Failed to write the provenance record: %v", err)
+	}
+
+	fmt.Println()
+	if exportedAppArtifact != "" {
+		if err := tools.ExportEnvironmentWithEnvman(apkEnvKey, exportedAppArtifact); err != nil {
+			return fmt.Errorf("Failed to export environment variable: %s", apkEnvKey)
+		}
+		logger.Printf("  Env    [ $%s = $BITRISE_DEPLOY_DIR/%s ]", apkEnvKey, filepath.Base(exportedAppArtifact))
 	}
-	logger.Printf("  Env    [ $%s = $BITRISE_DEPLOY_DIR/%s ]", apkEnvKey, filepath.Base(exportedAppArtifact))
 
 	if err := tools.ExportEnvironmentWithEnvman(testApkEnvKey, exportedTestArtifact); err != nil {
 		return fmt.Errorf("Failed to export environment variable: %s", apkEnvKey)
 	}
 	logger.Printf("  Env    [ $%s = $BITRISE_DEPLOY_DIR/%s ]", testApkEnvKey, filepath.Base(exportedTestArtifact))
 
-	var paths, sep string
-	for _, path := range exportedArtifactPaths {
-		paths += sep + "$BITRISE_DEPLOY_DIR/" + filepath.Base(path)
-		sep = "| \\\n" + strings.Repeat(" ", 11)
+	if len(exportedAppPaths) > 0 {
+		if err := exportPathList(apkListEnvKey, append(exportedAppPaths, exportedSplitPaths...)); err != nil {
+			return err
+		}
+	}
+	if err := exportPathList(testApkListEnvKey, exportedTestPaths); err != nil {
+		return err
+	}
+
+	envs := packageInfo.envs()
+	if !library {
+		envs = append(envs, app.envs()...)
+	}
+	for _, env := range envs {
+		if err := tools.ExportEnvironmentWithEnvman(env[0], env[1]); err != nil {
+			return fmt.Errorf("Failed to export environment variable: %s", env[0])
+		}
+		logger.Printf("  Env    [ $%s = %s ]", env[0], env[1])
+	}
+
+	if len(exportedSplitPaths) > 0 {
+		splitPaths := strings.Join(append([]string{exportedAppArtifact}, exportedSplitPaths...), "|")
+		if err := tools.ExportEnvironmentWithEnvman(apkSplitPathListEnvKey, splitPaths); err != nil {
+			return fmt.Errorf("Failed to export environment variable: %s", apkSplitPathListEnvKey)
+		}
+		logger.Printf("  Env    [ $%s = %s ]", apkSplitPathListEnvKey, splitPaths)
+	}
+
+	for _, envKey := range []string{orchestratorAPKEnvKey, testServicesAPKEnvKey} {
+		pth, ok := exportedTestUtilAPKs[envKey]
+		if !ok {
+			continue
+		}
+		if err := tools.ExportEnvironmentWithEnvman(envKey, pth); err != nil {
+			return fmt.Errorf("Failed to export environment variable: %s", envKey)
+		}
+		logger.Printf("  Env    [ $%s = $BITRISE_DEPLOY_DIR/%s ]", envKey, filepath.Base(pth))
+	}
+
+	for _, envKey := range []string{mappingEnvKey, testMappingEnvKey} {
+		pth, ok := exportedMappingFiles[envKey]
+		if !ok {
+			continue
+		}
+		if err := tools.ExportEnvironmentWithEnvman(envKey, pth); err != nil {
+			return fmt.Errorf("Failed to export environment variable: %s", envKey)
+		}
+		logger.Printf("  Env    [ $%s = $BITRISE_DEPLOY_DIR/%s ]", envKey, filepath.Base(pth))
+	}
+
+	for _, env := range [][2]string{{checksumsEnvKey, checksumsPath}, {provenanceEnvKey, provenancePath}} {
+		if err := tools.ExportEnvironmentWithEnvman(env[0], env[1]); err != nil {
+			return fmt.Errorf("Failed to export environment variable: %s", env[0])
+		}
+		logger.Printf("  Env    [ $%s = $BITRISE_DEPLOY_DIR/%s ]", env[0], filepath.Base(env[1]))
+	}
+
+	if config.GenerateFlankConfig && library {
+		logger.Warnf("The Flank config is not generated for library modules, Flank requires an app APK")
+	} else if config.GenerateFlankConfig {
+		flank := newFlankConfig(exportedAppArtifact, exportedTestArtifact, packageInfo, app, config.FlankDeviceModel, config.FlankAPILevels, config.FlankTestTargets, config.FlankMaxTestShards)
+		flankConfigPath, err := exportFlankConfig(flank, config.DeployDir, config.ArtifactNameCollision)
+		if err != nil {
+			return fmt.Errorf("Failed to write the Flank config: %v", err)
+		}
+		if err := tools.ExportEnvironmentWithEnvman(flankConfigEnvKey, flankConfigPath); err != nil {
+			return fmt.Errorf("Failed to export environment variable: %s", flankConfigEnvKey)
+		}
+		logger.Printf("  Env    [ $%s = $BITRISE_DEPLOY_DIR/%s ]", flankConfigEnvKey, filepath.Base(flankConfigPath))
+	}
+
+	if testBundlePath != "" {
+		if err := tools.ExportEnvironmentWithEnvman(testBundleEnvKey, testBundlePath); err != nil {
+			return fmt.Errorf("Failed to export environment variable: %s", testBundleEnvKey)
+		}
+		logger.Printf("  Env    [ $%s = $BITRISE_DEPLOY_DIR/%s ]", testBundleEnvKey, filepath.Base(testBundlePath))
+	}
+
+	if buildMetrics != nil {
+		buildMetricsPath, err := exportBuildMetrics(*buildMetrics, config.DeployDir)
+		if err != nil {
+			return err
+		}
+		if err := tools.ExportEnvironmentWithEnvman(buildMetricsEnvKey, buildMetricsPath); err != nil {
+			return fmt.Errorf("Failed to export environment variable: %s", buildMetricsEnvKey)
+		}
+		logger.Printf("  Env    [ $%s = $BITRISE_DEPLOY_DIR/%s ]", buildMetricsEnvKey, filepath.Base(buildMetricsPath))
 	}
 
 	return nil
 }
 
+// collectCache collects the cached paths for the branch-based cache, or exports the key-based cache manifests.
+func collectCache(config Configs) error {
+	if config.CacheLevel == string(utilscache.LevelNone) {
+		logger.Printf("  Caching is disabled")
+		return nil
+	}
+
+	var outputDirs []string
+	if config.CacheLevel == cacheLevelTestVariants {
+		targets, err := testVariantCacheTargets(config.ProjectLocation, config.Module, config.Variant, config.ModuleType)
+		if err != nil {
+			return fmt.Errorf("failed to find the variants to cache: %v", err)
+		}
+		if config.CacheMode != cacheModeKey {
+			return collectTestVariantCache(config.ProjectLocation, targets)
+		}
+		if outputDirs, err = testVariantCacheDirs(config.ProjectLocation, targets); err != nil {
+			return fmt.Errorf("failed to collect the build dirs of the variants: %v", err)
+		}
+	}
+
+	if config.CacheMode == cacheModeKey {
+		return collectKeyBasedCache(config.ProjectLocation, config.DeployDir, outputDirs)
+	}
+	return cache.Collect(config.ProjectLocation, utilscache.Level(config.CacheLevel), cmdFactory)
+}
+
 func failf(s string, args ...interface{}) {
 	logger.Errorf(s, args...)
 	os.Exit(1)
@@ -294,8 +842,8 @@ func main() {
 
 	fmt.Println()
 	logger.Infof("Collecting cache:")
-	if warning := cache.Collect(config.ProjectLocation, utilscache.Level(config.CacheLevel), cmdFactory); warning != nil {
-		logger.Warnf("%s", warning)
+	if err := collectCache(config); err != nil {
+		logger.Warnf("%s", err)
 	}
 
 	logger.Donef("  Done")
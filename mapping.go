@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/go-android/gradle"
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+const (
+	mappingEnvKey     = "BITRISE_MAPPING_PATH"
+	testMappingEnvKey = "BITRISE_TEST_MAPPING_PATH"
+	mappingFileName   = "mapping.txt"
+)
+
+// findMappingFile returns the R8/ProGuard mapping file of the variant: build/outputs/mapping/<variant>/mapping.txt
+// Returns an empty path if the variant is not minified.
+func findMappingFile(moduleDir, variant string) (string, error) {
+	mappingDir := filepath.Join(moduleDir, "build", "outputs", "mapping")
+	if exists, err := pathutil.IsDirExists(mappingDir); err != nil || !exists {
+		return "", err
+	}
+
+	entries, err := ioutil.ReadDir(mappingDir)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.EqualFold(entry.Name(), variant) {
+			continue
+		}
+		pth := filepath.Join(mappingDir, entry.Name(), mappingFileName)
+		if exists, err := pathutil.IsPathExists(pth); err != nil {
+			return "", err
+		} else if exists {
+			return pth, nil
+		}
+	}
+	return "", nil
+}
+
+// mappingVariant is a module variant whose mapping file is exported with the env key.
+type mappingVariant struct {
+	EnvKey  string
+	Module  string
+	Variant string
+}
+
+// mappingVariants returns the app and the AndroidTest variants of the module, or for a benchmark module
+// the variant of the app module it targets and the variant of the benchmark module itself.
+func mappingVariants(module, variant, moduleType, targetModule string) []mappingVariant {
+	if moduleType == moduleTypeBenchmark {
+		return []mappingVariant{{mappingEnvKey, targetModule, variant}, {testMappingEnvKey, module, variant}}
+	}
+	return []mappingVariant{{mappingEnvKey, module, variant}, {testMappingEnvKey, module, variant + testSuffix}}
+}
+
+// exportMappingFiles exports the mapping files of the variants as <module>-<variant>-mapping.txt,
+// the map holds the exported paths by their env keys.
+func exportMappingFiles(projectLocation string, variants []mappingVariant, deployDir, collisionPolicy string) (map[string]string, error) {
+	exported := map[string]string{}
+	for _, mapping := range variants {
+		pth, err := findMappingFile(moduleDir(projectLocation, mapping.Module), mapping.Variant)
+		if err != nil {
+			return nil, err
+		}
+		if pth == "" {
+			logger.Printf("  No mapping file found for the %s variant of %s", mapping.Variant, mapping.Module)
+			continue
+		}
+
+		name := fmt.Sprintf("%s-%s-%s", moduleName(mapping.Module), mapping.Variant, mappingFileName)
+		pths, err := exportArtifacts([]gradle.Artifact{{Path: pth, Name: name}}, deployDir, collisionPolicy)
+		if err != nil {
+			return nil, err
+		}
+		if len(pths) > 0 {
+			exported[mapping.EnvKey] = pths[0]
+		}
+	}
+	return exported, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_findMappingFile(t *testing.T) {
+	moduleDir := t.TempDir()
+	mappingDir := filepath.Join(moduleDir, "build", "outputs", "mapping")
+	appMapping := writeTestFile(t, filepath.Join(mappingDir, "freeRelease", "mapping.txt"), "com.example.A -> a:")
+	testMapping := writeTestFile(t, filepath.Join(mappingDir, "freeReleaseAndroidTest", "mapping.txt"), "com.example.ATest -> b:")
+	writeTestFile(t, filepath.Join(mappingDir, "paidRelease", "mapping.txt"), "com.example.A -> c:")
+
+	tests := []struct {
+		variant string
+		want    string
+	}{
+		{variant: "FreeRelease", want: appMapping},
+		{variant: "freeReleaseAndroidTest", want: testMapping},
+		{variant: "freeDebug", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.variant, func(t *testing.T) {
+			got, err := findMappingFile(moduleDir, tt.variant)
+			if err != nil {
+				t.Fatalf("findMappingFile() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("findMappingFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mappingVariants(t *testing.T) {
+	tests := []struct {
+		moduleType string
+		want       []mappingVariant
+	}{
+		{
+			moduleType: moduleTypeApplication,
+			want:       []mappingVariant{{mappingEnvKey, "app", "release"}, {testMappingEnvKey, "app", "releaseAndroidTest"}},
+		},
+		{
+			moduleType: moduleTypeBenchmark,
+			want:       []mappingVariant{{mappingEnvKey, "target", "release"}, {testMappingEnvKey, "app", "release"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.moduleType, func(t *testing.T) {
+			if got := mappingVariants("app", "release", tt.moduleType, "target"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mappingVariants() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
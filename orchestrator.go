@@ -0,0 +1,334 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+const (
+	orchestratorAPKEnvKey = "BITRISE_ORCHESTRATOR_APK_PATH"
+	testServicesAPKEnvKey = "BITRISE_TEST_SERVICES_APK_PATH"
+
+	orchestratorExecution = "ANDROIDX_TEST_ORCHESTRATOR"
+)
+
+var (
+	orchestratorExecutionPattern = regexp.MustCompile(`execution\s*=?\s*\(?\s*["']` + orchestratorExecution + `["']`)
+	blockCommentPattern          = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	// The // of URLs, like https://, is not a comment.
+	lineCommentPattern = regexp.MustCompile(`(?m)(^|[^:])//.*$`)
+)
+
+// resolveTestUtilTask is added to every project by resolveTestUtilInitScript, it resolves the androidTestUtil configuration
+// (which downloads the APKs into the Gradle cache) and prints the resolved artifacts, like:
+//
+//	bitrise-test-util: androidx.test:orchestrator:1.4.2 /root/.gradle/caches/modules-2/files-2.1/.../orchestrator-1.4.2.apk
+const (
+	resolveTestUtilTask       = "bitriseResolveAndroidTestUtil"
+	resolvedTestUtilPrefix    = "bitrise-test-util: "
+	resolveTestUtilInitScript = `gradle.allprojects { project ->
+    project.tasks.register("` + resolveTestUtilTask + `") {
+        doLast {
+            def configuration = project.configurations.findByName("androidTestUtil")
+            if (configuration != null && configuration.canBeResolved) {
+                configuration.resolvedConfiguration.resolvedArtifacts.each { artifact ->
+                    def id = artifact.moduleVersion.id
+                    println "` + resolvedTestUtilPrefix + `${id.group}:${id.name}:${id.version} ${artifact.file}"
+                }
+            }
+        }
+    }
+}
+`
+)
+
+// conventionPluginDirs are the included builds which hold the convention plugins of the project.
+var conventionPluginDirs = []string{"buildSrc", "build-logic"}
+
+// testUtilArtifact is a Maven artifact which is installed on the device next to the app and test APK.
+type testUtilArtifact struct {
+	Group    string
+	Name     string
+	EnvKey   string
+	Version  string
+	Location string
+}
+
+func (a testUtilArtifact) coordinates() string {
+	return a.Group + ":" + a.Name
+}
+
+func orchestratorArtifacts() []testUtilArtifact {
+	return []testUtilArtifact{
+		{Group: "androidx.test", Name: "orchestrator", EnvKey: orchestratorAPKEnvKey},
+		{Group: "androidx.test.services", Name: "test-services", EnvKey: testServicesAPKEnvKey},
+	}
+}
+
+// moduleDir returns the directory of a Gradle module, like: feature:nested-module => <project>/feature/nested-module
+func moduleDir(projectLocation, module string) string {
+	return filepath.Join(append([]string{projectLocation}, strings.Split(strings.Trim(module, ":"), ":")...)...)
+}
+
+// moduleName returns the name of the (nested) module, like: feature:login => login
+func moduleName(module string) string {
+	return filepath.Base(moduleDir("", module))
+}
+
+func moduleBuildFile(projectLocation, module string) (string, error) {
+	dir := moduleDir(projectLocation, module)
+	for _, name := range []string{"build.gradle", "build.gradle.kts"} {
+		pth := filepath.Join(dir, name)
+		if exists, err := pathutil.IsPathExists(pth); err != nil {
+			return "", err
+		} else if exists {
+			return pth, nil
+		}
+	}
+	return "", fmt.Errorf("no build.gradle or build.gradle.kts file found in (%s)", dir)
+}
+
+// stripComments removes the // and /* */ comments of a Groovy or Kotlin build script.
+func stripComments(content string) string {
+	content = blockCommentPattern.ReplaceAllString(content, "")
+	return lineCommentPattern.ReplaceAllString(content, "$1")
+}
+
+// usesOrchestrator checks if the build script configures the tests to be executed by the Android Test Orchestrator:
+//
+//	testOptions { execution 'ANDROIDX_TEST_ORCHESTRATOR' }
+//	testOptions { execution = "ANDROIDX_TEST_ORCHESTRATOR" }
+func usesOrchestrator(buildFileContent string) bool {
+	return orchestratorExecutionPattern.MatchString(stripComments(buildFileContent))
+}
+
+// orchestratorBuildScripts returns the build scripts which may configure the module's test execution:
+// the module's build file, the root build file (subprojects and allprojects blocks) and the convention plugins.
+func orchestratorBuildScripts(projectLocation, module string) ([]string, error) {
+	buildFile, err := moduleBuildFile(projectLocation, module)
+	if err != nil {
+		return nil, err
+	}
+	scripts := []string{buildFile}
+	if rootBuildFile, err := moduleBuildFile(projectLocation, ""); err == nil {
+		scripts = append(scripts, rootBuildFile)
+	}
+
+	for _, dir := range conventionPluginDirs {
+		dir = filepath.Join(projectLocation, dir)
+		if exists, err := pathutil.IsDirExists(dir); err != nil {
+			return nil, err
+		} else if !exists {
+			continue
+		}
+		if err := filepath.Walk(dir, func(pth string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if info.Name() == "build" || info.Name() == ".gradle" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(pth, ".gradle") || strings.HasSuffix(pth, ".gradle.kts") || strings.HasSuffix(pth, ".kt") || strings.HasSuffix(pth, ".groovy") {
+				scripts = append(scripts, pth)
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return scripts, nil
+}
+
+// dependencyVersion finds the version of the given dependency in a build file or in the output of the
+// Gradle dependencies task, like:
+//
+//	androidTestUtil 'androidx.test:orchestrator:1.4.2'
+//	+--- androidx.test:orchestrator:1.4.2
+//	\--- androidx.test:orchestrator:1.4.+ -> 1.4.2
+func dependencyVersion(content, coordinates string) string {
+	pattern := regexp.MustCompile(regexp.QuoteMeta(coordinates) + `:([0-9][\w.+\-]*)(?:\s*->\s*([0-9][\w.\-]*))?`)
+	version := ""
+	for _, match := range pattern.FindAllStringSubmatch(content, -1) {
+		if match[2] != "" {
+			return match[2]
+		}
+		if !strings.Contains(match[1], "+") {
+			version = match[1]
+		}
+	}
+	return version
+}
+
+// resolveTestUtilAPKs resolves the module's androidTestUtil configuration with the task of resolveTestUtilInitScript.
+// This covers the dependencies declared through version catalogs or variables, and downloads the APKs which are
+// not in the Gradle cache yet (the dependencies task only resolves the metadata).
+func resolveTestUtilAPKs(projectLocation, module string) (map[string]testUtilArtifact, error) {
+	initScript, err := ioutil.TempFile("", "resolve-test-util-*.gradle")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = os.Remove(initScript.Name())
+	}()
+	if _, err := initScript.WriteString(resolveTestUtilInitScript); err != nil {
+		return nil, err
+	}
+	if err := initScript.Close(); err != nil {
+		return nil, err
+	}
+
+	// The task reads the project at execution time, which is not compatible with the configuration cache.
+	args := []string{"--init-script", initScript.Name(), ":" + strings.Trim(module, ":") + ":" + resolveTestUtilTask, "--no-configuration-cache", "--console=plain", "--quiet"}
+	cmd := cmdFactory.Create(filepath.Join(projectLocation, "gradlew"), args, &command.Opts{Dir: projectLocation})
+	logger.Donef("$ %s", cmd.PrintableCommandArgs())
+	out, err := cmd.RunAndReturnTrimmedCombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("%s, %v", out, err)
+	}
+	return parseResolvedTestUtilAPKs(out), nil
+}
+
+// parseResolvedTestUtilAPKs parses the artifacts printed by the task of resolveTestUtilInitScript by their coordinates.
+func parseResolvedTestUtilAPKs(out string) map[string]testUtilArtifact {
+	artifacts := map[string]testUtilArtifact{}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, resolvedTestUtilPrefix) {
+			continue
+		}
+		fields := strings.SplitN(strings.TrimPrefix(line, resolvedTestUtilPrefix), " ", 2)
+		parts := strings.Split(fields[0], ":")
+		if len(fields) != 2 || len(parts) != 3 || !strings.HasSuffix(fields[1], ".apk") {
+			continue
+		}
+		artifact := testUtilArtifact{Group: parts[0], Name: parts[1], Version: parts[2], Location: fields[1]}
+		artifacts[artifact.coordinates()] = artifact
+	}
+	return artifacts
+}
+
+func gradleUserHome() string {
+	if pth := os.Getenv("GRADLE_USER_HOME"); pth != "" {
+		return pth
+	}
+	return filepath.Join(pathutil.UserHomeDir(), ".gradle")
+}
+
+// findTestUtilAPK looks up the artifact's APK in the local Gradle and Maven caches:
+//
+//	<gradle user home>/caches/modules-2/files-2.1/androidx.test/orchestrator/1.4.2/<sha1>/orchestrator-1.4.2.apk
+//	~/.m2/repository/androidx/test/orchestrator/1.4.2/orchestrator-1.4.2.apk
+//
+// The APK of a different version than the one the tests are built with is not used.
+func findTestUtilAPK(gradleHome, mavenRepository string, artifact testUtilArtifact) (string, error) {
+	gradleModuleDir := filepath.Join(gradleHome, "caches", "modules-2", "files-2.1", artifact.Group, artifact.Name)
+	mavenModuleDir := filepath.Join(append([]string{mavenRepository}, append(strings.Split(artifact.Group, "."), artifact.Name)...)...)
+
+	for _, moduleDir := range []string{gradleModuleDir, mavenModuleDir} {
+		apkName := fmt.Sprintf("%s-%s.apk", artifact.Name, artifact.Version)
+		matches, err := filepath.Glob(filepath.Join(pathutil.EscapeGlobPath(filepath.Join(moduleDir, artifact.Version)), "*", apkName))
+		if err != nil {
+			return "", err
+		}
+		matches = append(matches, filepath.Join(moduleDir, artifact.Version, apkName))
+		for _, pth := range matches {
+			if exists, err := pathutil.IsPathExists(pth); err != nil {
+				return "", err
+			} else if exists {
+				return pth, nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// findOrchestratorAPKs detects if the module's tests run with the Android Test Orchestrator
+// and locates the Orchestrator and Test Services APKs. Returns nil if the Orchestrator is not used.
+//
+// The APKs of the versions declared in the build scripts are looked up in the local Gradle and Maven caches first.
+// If a version is unknown or not cached, the androidTestUtil configuration is resolved with Gradle (if allowed by resolve),
+// which downloads the APKs.
+func findOrchestratorAPKs(projectLocation, module string, resolve bool) ([]testUtilArtifact, error) {
+	scripts, err := orchestratorBuildScripts(projectLocation, module)
+	if err != nil {
+		return nil, err
+	}
+	var contents []string
+	configured := false
+	for _, script := range scripts {
+		content, err := ioutil.ReadFile(script)
+		if err != nil {
+			return nil, err
+		}
+		contents = append(contents, stripComments(string(content)))
+		configured = configured || usesOrchestrator(string(content))
+	}
+	content := strings.Join(contents, "\n")
+
+	if !configured {
+		logger.Printf("The %s module does not use the Android Test Orchestrator", module)
+		return nil, nil
+	}
+	logger.Printf("The %s module uses the Android Test Orchestrator", module)
+
+	var resolved map[string]testUtilArtifact
+	resolveAttempted := false
+	artifacts := orchestratorArtifacts()
+	for i, artifact := range artifacts {
+		artifact.Version = dependencyVersion(content, artifact.coordinates())
+		if artifact.Version != "" {
+			pth, err := findTestUtilAPK(gradleUserHome(), filepath.Join(pathutil.UserHomeDir(), ".m2", "repository"), artifact)
+			if err != nil {
+				return nil, fmt.Errorf("failed to look up %s: %v", artifact.coordinates(), err)
+			}
+			if pth != "" {
+				artifact.Location = pth
+				artifacts[i] = artifact
+				continue
+			}
+		}
+
+		if !resolve {
+			logger.Warnf("%s (version: %s) not found in the local Gradle and Maven caches", artifact.coordinates(), orUnknown(artifact.Version))
+			continue
+		}
+		if !resolveAttempted {
+			resolveAttempted = true
+			if resolved, err = resolveTestUtilAPKs(projectLocation, module); err != nil {
+				logger.Warnf("Failed to resolve the androidTestUtil dependencies: %v", err)
+			}
+		}
+		if r, ok := resolved[artifact.coordinates()]; ok {
+			artifact.Version, artifact.Location = r.Version, r.Location
+			artifacts[i] = artifact
+			continue
+		}
+		logger.Warnf("%s is not an androidTestUtil dependency of the %s module, skipping it", artifact.coordinates(), module)
+	}
+
+	var found []testUtilArtifact
+	for _, artifact := range artifacts {
+		if artifact.Location != "" {
+			found = append(found, artifact)
+		}
+	}
+	return found, nil
+}
+
+func orUnknown(version string) string {
+	if version == "" {
+		return "unknown"
+	}
+	return version
+}
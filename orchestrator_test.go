@@ -0,0 +1,213 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_dependencyVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		coordinates string
+		want        string
+	}{
+		{
+			name:        "groovy build file",
+			content:     "dependencies {\n    androidTestUtil 'androidx.test:orchestrator:1.4.2'\n}",
+			coordinates: "androidx.test:orchestrator",
+			want:        "1.4.2",
+		},
+		{
+			name:        "kotlin build file",
+			content:     `androidTestUtil("androidx.test.services:test-services:1.4.2")`,
+			coordinates: "androidx.test.services:test-services",
+			want:        "1.4.2",
+		},
+		{
+			name:        "version catalog",
+			content:     "androidTestUtil(libs.androidx.test.orchestrator)",
+			coordinates: "androidx.test:orchestrator",
+			want:        "",
+		},
+		{
+			name:        "dependencies task output with dynamic version",
+			content:     "androidTestUtil\n\\--- androidx.test:orchestrator:1.4.+ -> 1.4.2\n",
+			coordinates: "androidx.test:orchestrator",
+			want:        "1.4.2",
+		},
+		{
+			name:        "does not match other artifacts of the group",
+			content:     "androidTestImplementation 'androidx.test:runner:1.5.2'",
+			coordinates: "androidx.test:orchestrator",
+			want:        "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dependencyVersion(tt.content, tt.coordinates); got != tt.want {
+				t.Errorf("dependencyVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_findTestUtilAPK(t *testing.T) {
+	gradleHome := t.TempDir()
+	mavenRepository := t.TempDir()
+	gradleModuleDir := filepath.Join(gradleHome, "caches", "modules-2", "files-2.1", "androidx.test", "orchestrator")
+	writeTestFile(t, filepath.Join(gradleModuleDir, "1.4.1", "aaaa", "orchestrator-1.4.1.apk"), "apk")
+	writeTestFile(t, filepath.Join(gradleModuleDir, "1.4.2", "bbbb", "orchestrator-1.4.2.apk"), "apk")
+	writeTestFile(t, filepath.Join(gradleModuleDir, "1.4.2", "cccc", "orchestrator-1.4.2.pom"), "pom")
+	writeTestFile(t, filepath.Join(mavenRepository, "androidx", "test", "services", "test-services", "1.4.2", "test-services-1.4.2.apk"), "apk")
+
+	tests := []struct {
+		name     string
+		artifact testUtilArtifact
+		wantPth  string
+	}{
+		{
+			name:     "version from Gradle cache",
+			artifact: testUtilArtifact{Group: "androidx.test", Name: "orchestrator", Version: "1.4.1"},
+			wantPth:  filepath.Join(gradleModuleDir, "1.4.1", "aaaa", "orchestrator-1.4.1.apk"),
+		},
+		{
+			name:     "Maven repository",
+			artifact: testUtilArtifact{Group: "androidx.test.services", Name: "test-services", Version: "1.4.2"},
+			wantPth:  filepath.Join(mavenRepository, "androidx", "test", "services", "test-services", "1.4.2", "test-services-1.4.2.apk"),
+		},
+		{
+			name:     "not cached version",
+			artifact: testUtilArtifact{Group: "androidx.test", Name: "orchestrator", Version: "1.5.0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pth, err := findTestUtilAPK(gradleHome, mavenRepository, tt.artifact)
+			if err != nil {
+				t.Fatalf("findTestUtilAPK() error = %v", err)
+			}
+			if pth != tt.wantPth {
+				t.Errorf("findTestUtilAPK() = %s, want %s", pth, tt.wantPth)
+			}
+		})
+	}
+}
+
+func Test_moduleDir(t *testing.T) {
+	if got := moduleDir("/project", "feature:nested-module"); got != "/project/feature/nested-module" {
+		t.Errorf("moduleDir() = %s", got)
+	}
+	if got := moduleDir("/project", ":app"); got != "/project/app" {
+		t.Errorf("moduleDir() = %s", got)
+	}
+}
+
+func Test_usesOrchestrator(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{name: "groovy", content: "android { testOptions { execution 'ANDROIDX_TEST_ORCHESTRATOR' } }", want: true},
+		{name: "kotlin", content: `android { testOptions { execution = "ANDROIDX_TEST_ORCHESTRATOR" } }`, want: true},
+		{name: "line comment", content: "android { testOptions {\n// execution 'ANDROIDX_TEST_ORCHESTRATOR'\n} }", want: false},
+		{name: "block comment", content: "android { testOptions { /* execution = \"ANDROIDX_TEST_ORCHESTRATOR\" */ } }", want: false},
+		{name: "url before", content: "repositories { maven { url 'https://example.com/maven' } }\nandroid { testOptions { execution 'ANDROIDX_TEST_ORCHESTRATOR' } }", want: true},
+		{name: "not configured", content: "android { testOptions { animationsDisabled = true } }", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := usesOrchestrator(tt.content); got != tt.want {
+				t.Errorf("usesOrchestrator() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_orchestratorBuildScripts(t *testing.T) {
+	project := t.TempDir()
+	writeTestFile(t, filepath.Join(project, "build.gradle"), "subprojects {}")
+	writeTestFile(t, filepath.Join(project, "app", "build.gradle.kts"), "plugins {}")
+	writeTestFile(t, filepath.Join(project, "build-logic", "convention", "src", "main", "kotlin", "AndroidConventionPlugin.kt"), "class AndroidConventionPlugin")
+	writeTestFile(t, filepath.Join(project, "build-logic", "convention", "build", "classes", "Generated.kt"), "")
+	writeTestFile(t, filepath.Join(project, "buildSrc", "build.gradle.kts"), "plugins {}")
+
+	got, err := orchestratorBuildScripts(project, "app")
+	if err != nil {
+		t.Fatalf("orchestratorBuildScripts() error = %v", err)
+	}
+
+	want := []string{
+		filepath.Join(project, "app", "build.gradle.kts"),
+		filepath.Join(project, "build.gradle"),
+		filepath.Join(project, "buildSrc", "build.gradle.kts"),
+		filepath.Join(project, "build-logic", "convention", "src", "main", "kotlin", "AndroidConventionPlugin.kt"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("orchestratorBuildScripts() = %v, want %v", got, want)
+	}
+}
+
+func Test_parseResolvedTestUtilAPKs(t *testing.T) {
+	out := `> Task :app:bitriseResolveAndroidTestUtil
+bitrise-test-util: androidx.test:orchestrator:1.4.2 /gradle/caches/modules-2/files-2.1/androidx.test/orchestrator/1.4.2/aaaa/orchestrator-1.4.2.apk
+bitrise-test-util: androidx.test.services:test-services:1.4.2 /gradle/caches/modules-2/files-2.1/androidx.test.services/test-services/1.4.2/bbbb/test-services-1.4.2.apk
+bitrise-test-util: androidx.test:monitor:1.6.1 /gradle/caches/modules-2/files-2.1/androidx.test/monitor/1.6.1/cccc/monitor-1.6.1.aar`
+
+	want := map[string]testUtilArtifact{
+		"androidx.test:orchestrator": {
+			Group: "androidx.test", Name: "orchestrator", Version: "1.4.2",
+			Location: "/gradle/caches/modules-2/files-2.1/androidx.test/orchestrator/1.4.2/aaaa/orchestrator-1.4.2.apk",
+		},
+		"androidx.test.services:test-services": {
+			Group: "androidx.test.services", Name: "test-services", Version: "1.4.2",
+			Location: "/gradle/caches/modules-2/files-2.1/androidx.test.services/test-services/1.4.2/bbbb/test-services-1.4.2.apk",
+		},
+	}
+	if got := parseResolvedTestUtilAPKs(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseResolvedTestUtilAPKs() = %v, want %v", got, want)
+	}
+}
+
+func Test_findOrchestratorAPKs_withoutResolve(t *testing.T) {
+	gradleHome := t.TempDir()
+	original, set := os.LookupEnv("GRADLE_USER_HOME")
+	if err := os.Setenv("GRADLE_USER_HOME", gradleHome); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if set {
+			_ = os.Setenv("GRADLE_USER_HOME", original)
+		} else {
+			_ = os.Unsetenv("GRADLE_USER_HOME")
+		}
+	}()
+	apkPth := filepath.Join(gradleHome, "caches", "modules-2", "files-2.1", "androidx.test", "orchestrator", "1.4.2", "aaaa", "orchestrator-1.4.2.apk")
+	writeTestFile(t, apkPth, "apk")
+
+	project := t.TempDir()
+	writeTestFile(t, filepath.Join(project, "app", "build.gradle"), `android { testOptions { execution 'ANDROIDX_TEST_ORCHESTRATOR' } }
+dependencies {
+    androidTestUtil 'androidx.test:orchestrator:1.4.2'
+    androidTestUtil libs.androidx.test.services
+}`)
+	writeTestFile(t, filepath.Join(project, "lib", "build.gradle"), "apply plugin: 'com.android.library'")
+
+	// Without resolving, the APKs are only looked up in the local caches and no Gradle command is run.
+	got, err := findOrchestratorAPKs(project, "app", false)
+	if err != nil {
+		t.Fatalf("findOrchestratorAPKs() error = %v", err)
+	}
+	want := []testUtilArtifact{{Group: "androidx.test", Name: "orchestrator", EnvKey: orchestratorAPKEnvKey, Version: "1.4.2", Location: apkPth}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findOrchestratorAPKs() = %v, want %v", got, want)
+	}
+
+	// A module without the Orchestrator does not resolve anything, even if resolving is allowed.
+	if got, err := findOrchestratorAPKs(project, "lib", true); err != nil || got != nil {
+		t.Errorf("findOrchestratorAPKs() = %v, %v, want nil", got, err)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/go-android/gradle"
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+// outputMetadataFileName is the file AGP (4.1+) writes next to the outputs of every variant.
+const outputMetadataFileName = "output-metadata.json"
+
+// outputMetadata is the content of an output-metadata.json file, like:
+//
+//	{
+//	  "version": 3,
+//	  "artifactType": {"type": "APK", "kind": "Directory"},
+//	  "applicationId": "com.example.app",
+//	  "variantName": "debug",
+//	  "elements": [{"type": "SINGLE", "filters": [], "versionCode": 1, "versionName": "1.0", "outputFile": "app-debug.apk"}],
+//	  "elementType": "File"
+//	}
+type outputMetadata struct {
+	ArtifactType struct {
+		Type string `json:"type"`
+	} `json:"artifactType"`
+	ApplicationID string          `json:"applicationId"`
+	VariantName   string          `json:"variantName"`
+	Elements      []outputElement `json:"elements"`
+}
+
+type outputElement struct {
+	Type       string         `json:"type"`
+	Filters    []outputFilter `json:"filters"`
+	OutputFile string         `json:"outputFile"`
+}
+
+// outputFilter is a split filter of an output, like: {"filterType": "ABI", "value": "x86_64"}
+type outputFilter struct {
+	FilterType string `json:"filterType"`
+	Value      string `json:"value"`
+}
+
+// apkSet holds the app and the test APKs of the selected variant.
+type apkSet struct {
+	App  []gradle.Artifact
+	Test []gradle.Artifact
+	// Filters holds the split filters of the APKs located through the output metadata, by APK path.
+	Filters map[string][]outputFilter
+}
+
+func (s apkSet) all() []gradle.Artifact {
+	return append(append([]gradle.Artifact{}, s.App...), s.Test...)
+}
+
+func (s apkSet) empty() bool {
+	return len(s.App) == 0 && len(s.Test) == 0
+}
+
+// splitAPKsByName tells the app and the test APKs apart by their file names,
+// used when the APKs are not located through the output metadata.
+func splitAPKsByName(artifacts []gradle.Artifact) apkSet {
+	var set apkSet
+	for _, artifact := range artifacts {
+		if isTestAPK(artifact.Path) {
+			set.Test = append(set.Test, artifact)
+		} else {
+			set.App = append(set.App, artifact)
+		}
+	}
+	return set
+}
+
+// findOutputMetadataAPKs returns the APKs of the given variant and its AndroidTest variant,
+// as listed by the output-metadata.json files of the module's build/outputs/apk directory.
+// Returns an empty set if the module has no output metadata (AGP versions before 4.1).
+func findOutputMetadataAPKs(moduleDir, variant string) (apkSet, error) {
+	outputsDir := filepath.Join(moduleDir, "build", "outputs", "apk")
+	if exists, err := pathutil.IsDirExists(outputsDir); err != nil || !exists {
+		return apkSet{}, err
+	}
+
+	set := apkSet{Filters: map[string][]outputFilter{}}
+	err := filepath.Walk(outputsDir, func(pth string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != outputMetadataFileName {
+			return nil
+		}
+
+		metadata, err := readOutputMetadata(pth)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", pth, err)
+		}
+		if metadata.ArtifactType.Type != "APK" {
+			return nil
+		}
+
+		var test bool
+		switch {
+		case strings.EqualFold(metadata.VariantName, variant):
+			test = false
+		case strings.EqualFold(metadata.VariantName, variant+testSuffix):
+			test = true
+		default:
+			return nil
+		}
+
+		for _, element := range metadata.Elements {
+			apkPth := filepath.Join(filepath.Dir(pth), element.OutputFile)
+			if exists, err := pathutil.IsPathExists(apkPth); err != nil {
+				return err
+			} else if !exists {
+				return fmt.Errorf("%s lists a missing APK: %s", pth, element.OutputFile)
+			}
+
+			artifact := gradle.Artifact{Path: apkPth, Name: filepath.Base(apkPth)}
+			set.Filters[apkPth] = element.Filters
+			if test {
+				set.Test = append(set.Test, artifact)
+			} else {
+				set.App = append(set.App, artifact)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return apkSet{}, err
+	}
+	return set, nil
+}
+
+func readOutputMetadata(pth string) (outputMetadata, error) {
+	data, err := ioutil.ReadFile(pth)
+	if err != nil {
+		return outputMetadata{}, err
+	}
+	var metadata outputMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return outputMetadata{}, err
+	}
+	return metadata, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bitrise-io/go-android/gradle"
+)
+
+func Test_findOutputMetadataAPKs(t *testing.T) {
+	moduleDir := t.TempDir()
+	outputsDir := filepath.Join(moduleDir, "build", "outputs", "apk")
+
+	writeTestFile(t, filepath.Join(outputsDir, "free", "debug", "app-free-debug.apk"), "app")
+	writeTestFile(t, filepath.Join(outputsDir, "free", "debug", outputMetadataFileName), `{
+  "version": 3,
+  "artifactType": {"type": "APK", "kind": "Directory"},
+  "applicationId": "com.example.app",
+  "variantName": "freeDebug",
+  "elements": [{"type": "SINGLE", "filters": [], "outputFile": "app-free-debug.apk"}]
+}`)
+	writeTestFile(t, filepath.Join(outputsDir, "androidTest", "free", "debug", "app-free-debug-androidTest.apk"), "test")
+	writeTestFile(t, filepath.Join(outputsDir, "androidTest", "free", "debug", outputMetadataFileName), `{
+  "version": 3,
+  "artifactType": {"type": "APK", "kind": "Directory"},
+  "applicationId": "com.example.app.test",
+  "variantName": "freeDebugAndroidTest",
+  "elements": [{"type": "SINGLE", "filters": [], "outputFile": "app-free-debug-androidTest.apk"}]
+}`)
+	writeTestFile(t, filepath.Join(outputsDir, "paid", "debug", "app-paid-debug.apk"), "other variant")
+	writeTestFile(t, filepath.Join(outputsDir, "paid", "debug", outputMetadataFileName), `{
+  "artifactType": {"type": "APK", "kind": "Directory"},
+  "variantName": "paidDebug",
+  "elements": [{"type": "SINGLE", "filters": [], "outputFile": "app-paid-debug.apk"}]
+}`)
+
+	got, err := findOutputMetadataAPKs(moduleDir, "FreeDebug")
+	if err != nil {
+		t.Fatalf("findOutputMetadataAPKs() error = %v", err)
+	}
+
+	want := apkSet{
+		App: []gradle.Artifact{{
+			Path: filepath.Join(outputsDir, "free", "debug", "app-free-debug.apk"),
+			Name: "app-free-debug.apk",
+		}},
+		Test: []gradle.Artifact{{
+			Path: filepath.Join(outputsDir, "androidTest", "free", "debug", "app-free-debug-androidTest.apk"),
+			Name: "app-free-debug-androidTest.apk",
+		}},
+		Filters: map[string][]outputFilter{
+			filepath.Join(outputsDir, "free", "debug", "app-free-debug.apk"):                            {},
+			filepath.Join(outputsDir, "androidTest", "free", "debug", "app-free-debug-androidTest.apk"): {},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findOutputMetadataAPKs() = %v, want %v", got, want)
+	}
+}
+
+func Test_findOutputMetadataAPKs_noMetadata(t *testing.T) {
+	moduleDir := t.TempDir()
+	writeTestFile(t, filepath.Join(moduleDir, "build", "outputs", "apk", "debug", "app-debug.apk"), "app")
+
+	got, err := findOutputMetadataAPKs(moduleDir, "debug")
+	if err != nil {
+		t.Fatalf("findOutputMetadataAPKs() error = %v", err)
+	}
+	if !got.empty() {
+		t.Errorf("findOutputMetadataAPKs() = %v, want no APKs", got)
+	}
+}
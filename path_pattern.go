@@ -0,0 +1,168 @@
+package main
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const excludePatternPrefix = "!"
+
+// pathPatterns selects files with doublestar glob patterns: `*` matches any characters within a path segment,
+// `**` matches any number of path segments. A file is selected if it matches any of the include patterns
+// and none of the exclude patterns.
+//
+// A single pattern without `**` and `!` is a legacy pattern (like the former default, */build/outputs/apk/*.apk),
+// it also selects the files whose absolute path matches it with `*` matching any characters, including `/`.
+type pathPatterns struct {
+	Include []string
+	Exclude []string
+	Legacy  bool
+}
+
+// patternDecision explains why a candidate file was selected or skipped.
+type patternDecision struct {
+	Path     string
+	Pattern  string
+	Selected bool
+}
+
+// parsePathPatterns parses the newline separated patterns, the ones with a `!` prefix are exclude patterns.
+func parsePathPatterns(lines []string) pathPatterns {
+	var patterns pathPatterns
+	for _, line := range lines {
+		for _, pattern := range strings.Split(line, "\n") {
+			pattern = strings.TrimSpace(pattern)
+			if pattern == "" {
+				continue
+			}
+			if strings.HasPrefix(pattern, excludePatternPrefix) {
+				patterns.Exclude = append(patterns.Exclude, strings.TrimPrefix(pattern, excludePatternPrefix))
+			} else {
+				patterns.Include = append(patterns.Include, pattern)
+			}
+		}
+	}
+	patterns.Legacy = len(patterns.Include) == 1 && len(patterns.Exclude) == 0 && !strings.Contains(patterns.Include[0], "**")
+	return patterns
+}
+
+func (p pathPatterns) String() string {
+	patterns := append([]string{}, p.Include...)
+	for _, pattern := range p.Exclude {
+		patterns = append(patterns, excludePatternPrefix+pattern)
+	}
+	return strings.Join(patterns, ", ")
+}
+
+// match matches the path relative to the project (and the absolute path for the absolute patterns).
+// The returned decision is nil if the file is not a candidate: its name does not match any of the include patterns.
+func (p pathPatterns) match(projectLocation, pth string) *patternDecision {
+	rel := relativePath(projectLocation, pth)
+
+	var candidate bool
+	for _, pattern := range p.Include {
+		if !matchGlob(pattern, patternSubject(pattern, rel, pth)) && !(p.Legacy && matchLegacyPattern(pattern, filepath.ToSlash(pth))) {
+			if matchGlob(path.Base(pattern), path.Base(rel)) {
+				candidate = true
+			}
+			continue
+		}
+
+		for _, exclude := range p.Exclude {
+			if matchGlob(exclude, patternSubject(exclude, rel, pth)) {
+				return &patternDecision{Path: rel, Pattern: excludePatternPrefix + exclude}
+			}
+		}
+		return &patternDecision{Path: rel, Pattern: pattern, Selected: true}
+	}
+
+	if !candidate {
+		return nil
+	}
+	return &patternDecision{Path: rel}
+}
+
+// excludesDir reports whether everything under the directory is excluded, so it does not need to be walked.
+func (p pathPatterns) excludesDir(projectLocation, dir string) bool {
+	rel := relativePath(projectLocation, dir)
+	for _, exclude := range p.Exclude {
+		prefix := strings.TrimSuffix(exclude, "/**")
+		if prefix != exclude && matchGlob(prefix, patternSubject(prefix, rel, dir)) {
+			return true
+		}
+	}
+	return false
+}
+
+func relativePath(projectLocation, pth string) string {
+	rel, err := filepath.Rel(projectLocation, pth)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(pth)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func patternSubject(pattern, rel, abs string) string {
+	if path.IsAbs(pattern) {
+		return filepath.ToSlash(abs)
+	}
+	return rel
+}
+
+// matchLegacyPattern matches the pattern against the path, `*` matches any sequence of characters, including `/`.
+func matchLegacyPattern(pattern, pth string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == pth
+	}
+
+	if !strings.HasPrefix(pth, parts[0]) {
+		return false
+	}
+	pth = pth[len(parts[0]):]
+
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(pth, part)
+		if i < 0 {
+			return false
+		}
+		pth = pth[i+len(part):]
+	}
+	return len(pth) >= len(last) && strings.HasSuffix(pth, last)
+}
+
+// matchGlob matches the slash separated path against the doublestar pattern.
+// Path segments are matched with path.Match, a `**` segment matches zero or more segments.
+func matchGlob(pattern, pth string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(pth, "/"))
+}
+
+func matchSegments(pattern, pth []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for len(pattern) > 1 && pattern[1] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(pth); i++ {
+				if matchSegments(pattern[1:], pth[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(pth) == 0 {
+			return false
+		}
+		if matched, err := path.Match(pattern[0], pth[0]); err != nil || !matched {
+			return false
+		}
+		pattern, pth = pattern[1:], pth[1:]
+	}
+	return len(pth) == 0
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_matchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		pth     string
+		want    bool
+	}{
+		{pattern: "app/build/outputs/apk/**/*.apk", pth: "app/build/outputs/apk/debug/app-debug.apk", want: true},
+		{pattern: "app/build/outputs/apk/**/*.apk", pth: "app/build/outputs/apk/app-debug.apk", want: true},
+		{pattern: "app/build/outputs/apk/**/*.apk", pth: "lib/build/outputs/apk/debug/lib-debug.apk", want: false},
+		{pattern: "*/build/outputs/apk/*.apk", pth: "app/build/outputs/apk/debug/app-debug.apk", want: false},
+		{pattern: "**/intermediates/**", pth: "app/build/intermediates/apk/debug/app-debug.apk", want: true},
+		{pattern: "**/intermediates/**", pth: "app/build/outputs/apk/debug/app-debug.apk", want: false},
+		{pattern: "**/*-androidTest.apk", pth: "app-debug-androidTest.apk", want: true},
+		{pattern: "**/**/*.apk", pth: "a/b/c.apk", want: true},
+		{pattern: "app/*/app-?.apk", pth: "app/debug/app-a.apk", want: true},
+		{pattern: "[", pth: "[", want: false},
+		{pattern: "/project/**/*.apk", pth: "/project/app/app.apk", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.pth, func(t *testing.T) {
+			if got := matchGlob(tt.pattern, tt.pth); got != tt.want {
+				t.Errorf("matchGlob() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parsePathPatterns(t *testing.T) {
+	got := parsePathPatterns([]string{"app/build/outputs/apk/**/*.apk", "", " !**/intermediates/** ", "**/*-androidTest.apk"})
+	want := pathPatterns{
+		Include: []string{"app/build/outputs/apk/**/*.apk", "**/*-androidTest.apk"},
+		Exclude: []string{"**/intermediates/**"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parsePathPatterns() = %v, want %v", got, want)
+	}
+}
+
+func Test_pathPatterns_match(t *testing.T) {
+	patterns := parsePathPatterns([]string{"**/build/**/*.apk", "!**/intermediates/**", "!**/*-unsigned.apk"})
+
+	tests := []struct {
+		pth  string
+		want *patternDecision
+	}{
+		{
+			pth:  "/project/app/build/outputs/apk/debug/app-debug.apk",
+			want: &patternDecision{Path: "app/build/outputs/apk/debug/app-debug.apk", Pattern: "**/build/**/*.apk", Selected: true},
+		},
+		{
+			pth:  "/project/app/build/intermediates/apk/debug/app-debug.apk",
+			want: &patternDecision{Path: "app/build/intermediates/apk/debug/app-debug.apk", Pattern: "!**/intermediates/**"},
+		},
+		{
+			pth:  "/project/app/build/outputs/apk/release/app-release-unsigned.apk",
+			want: &patternDecision{Path: "app/build/outputs/apk/release/app-release-unsigned.apk", Pattern: "!**/*-unsigned.apk"},
+		},
+		{
+			pth:  "/project/app/release/app-release.apk",
+			want: &patternDecision{Path: "app/release/app-release.apk"},
+		},
+		{
+			pth:  "/project/app/build/outputs/apk/debug/output-metadata.json",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pth, func(t *testing.T) {
+			if got := patterns.match("/project", tt.pth); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_pathPatterns_excludesDir(t *testing.T) {
+	patterns := parsePathPatterns([]string{"**/*.apk", "!**/intermediates/**", "!**/*-unsigned.apk"})
+
+	if !patterns.excludesDir("/project", "/project/app/build/intermediates") {
+		t.Errorf("excludesDir() = false, want true for the intermediates")
+	}
+	if patterns.excludesDir("/project", "/project/app/build/outputs") {
+		t.Errorf("excludesDir() = true, want false for the outputs")
+	}
+}
+
+func Test_pathPatterns_match_legacy(t *testing.T) {
+	legacy := parsePathPatterns([]string{"*/build/outputs/apk/*.apk"})
+	if !legacy.Legacy {
+		t.Fatalf("parsePathPatterns() Legacy = false, want true")
+	}
+	got := legacy.match("/project", "/project/app/build/outputs/apk/debug/app-debug.apk")
+	want := &patternDecision{Path: "app/build/outputs/apk/debug/app-debug.apk", Pattern: "*/build/outputs/apk/*.apk", Selected: true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("match() = %+v, want %+v", got, want)
+	}
+
+	for _, lines := range [][]string{
+		{"*/build/outputs/apk/*.apk", "!**/intermediates/**"},
+		{"**/build/outputs/apk/*.apk"},
+	} {
+		patterns := parsePathPatterns(lines)
+		if patterns.Legacy {
+			t.Errorf("parsePathPatterns(%v) Legacy = true, want false", lines)
+		}
+		if got := patterns.match("/project", "/project/app/build/outputs/apk/debug/app-debug.apk"); got != nil && got.Selected {
+			t.Errorf("match() = %+v, want not selected", got)
+		}
+	}
+}
+
+func Test_matchLegacyPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		pth     string
+		want    bool
+	}{
+		{pattern: "*/build/outputs/apk/*.apk", pth: "/project/app/build/outputs/apk/debug/app-debug.apk", want: true},
+		{pattern: "*/build/outputs/apk/*.apk", pth: "/project/app/build/intermediates/apk/debug/app-debug.apk", want: false},
+		{pattern: "*.apk", pth: "/project/app.apk", want: true},
+		{pattern: "/project/app.apk", pth: "/project/app.apk", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.pth, func(t *testing.T) {
+			if got := matchLegacyPattern(tt.pattern, tt.pth); got != tt.want {
+				t.Errorf("matchLegacyPattern() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
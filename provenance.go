@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-utils/command"
+)
+
+const (
+	checksumsEnvKey    = "BITRISE_APK_CHECKSUMS_PATH"
+	provenanceEnvKey   = "BITRISE_PROVENANCE_PATH"
+	checksumsFileName  = "apk-checksums.txt"
+	provenanceFileName = "provenance.json"
+)
+
+// stepVersion is the version of the step recorded in the provenance, set at build time with:
+//
+//	go build -ldflags "-X main.stepVersion=<version>"
+var stepVersion = "unknown"
+
+// Roles of the exported artifacts, in addition to the test bundle roles.
+const splitRole = "split"
+
+// provenance records how the exported artifacts were built.
+type provenance struct {
+	StepVersion   string               `json:"step_version"`
+	CreatedAt     time.Time            `json:"created_at"`
+	Module        string               `json:"module"`
+	Variant       string               `json:"variant"`
+	GradleCommand string               `json:"gradle_command"`
+	Reused        bool                 `json:"reused"`
+	GitCommit     string               `json:"git_commit"`
+	GradleVersion string               `json:"gradle_version"`
+	AGPVersion    string               `json:"agp_version"`
+	JDKVersion    string               `json:"jdk_version"`
+	Artifacts     []provenanceArtifact `json:"artifacts"`
+}
+
+type provenanceArtifact struct {
+	Name   string `json:"name"`
+	Role   string `json:"role"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+func newProvenanceArtifact(pth, role string) (provenanceArtifact, error) {
+	info, err := os.Stat(pth)
+	if err != nil {
+		return provenanceArtifact{}, err
+	}
+	hash, err := fileSHA256(pth)
+	if err != nil {
+		return provenanceArtifact{}, err
+	}
+	return provenanceArtifact{Name: filepath.Base(pth), Role: role, Size: info.Size(), SHA256: hash}, nil
+}
+
+var (
+	wrapperDistributionPattern = regexp.MustCompile(`(?m)^distributionUrl=.*gradle-([\w.\-]+?)-(?:bin|all)\.zip`)
+	agpPluginPattern           = regexp.MustCompile(`id\s*\(?\s*["']com\.android\.(?:application|library|test)["']\s*\)?\s*version\s*["']([^"']+)["']`)
+	javaReleaseVersionPattern  = regexp.MustCompile(`(?m)^JAVA_VERSION="([^"]+)"`)
+	catalogAGPEntryPattern     = regexp.MustCompile(`"com\.android\.tools\.build:gradle"|id\s*=\s*"com\.android\.(?:application|library|test)"`)
+	catalogVersionPattern      = regexp.MustCompile(`version\s*=\s*"([^"]+)"`)
+	catalogVersionRefPattern   = regexp.MustCompile(`version\.ref\s*=\s*"([^"]+)"`)
+)
+
+// wrapperGradleVersion reads the Gradle version from the distribution URL of gradle-wrapper.properties, like:
+//
+//	distributionUrl=https\://services.gradle.org/distributions/gradle-8.7-bin.zip
+func wrapperGradleVersion(properties string) string {
+	if match := wrapperDistributionPattern.FindStringSubmatch(properties); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// agpVersion reads the Android Gradle Plugin version from a build script or a version catalog, like:
+//
+//	classpath 'com.android.tools.build:gradle:8.4.0'
+//	id 'com.android.application' version '8.4.0'
+//	android-gradle = { module = "com.android.tools.build:gradle", version.ref = "agp" }
+//	android-application = { id = "com.android.application", version = "8.4.0" }
+func agpVersion(content string) string {
+	if version := dependencyVersion(content, "com.android.tools.build:gradle"); version != "" {
+		return version
+	}
+	if match := agpPluginPattern.FindStringSubmatch(content); match != nil {
+		return match[1]
+	}
+
+	// Version catalog entries
+	for _, line := range strings.Split(content, "\n") {
+		if !catalogAGPEntryPattern.MatchString(line) {
+			continue
+		}
+		if match := catalogVersionPattern.FindStringSubmatch(line); match != nil {
+			return match[1]
+		}
+		if match := catalogVersionRefPattern.FindStringSubmatch(line); match != nil {
+			if version := regexp.MustCompile(`(?m)^\s*` + regexp.QuoteMeta(match[1]) + `\s*=\s*"([^"]+)"`).FindStringSubmatch(content); version != nil {
+				return version[1]
+			}
+		}
+	}
+	return ""
+}
+
+// readToolVersions returns the Gradle, AGP and JDK versions of the project, without running Gradle:
+// the Gradle version is read from the wrapper properties, the AGP version from the root build scripts
+// and the version catalog, the JDK version from the release file of JAVA_HOME.
+func readToolVersions(projectLocation string) (gradleVersion, agpVer, jdkVersion string) {
+	readFile := func(pth string) string {
+		content, err := ioutil.ReadFile(pth)
+		if err != nil {
+			return ""
+		}
+		return string(content)
+	}
+
+	gradleVersion = wrapperGradleVersion(readFile(filepath.Join(projectLocation, "gradle", "wrapper", "gradle-wrapper.properties")))
+
+	for _, name := range []string{"build.gradle", "build.gradle.kts", "settings.gradle", "settings.gradle.kts", filepath.Join("gradle", "libs.versions.toml")} {
+		if agpVer = agpVersion(readFile(filepath.Join(projectLocation, name))); agpVer != "" {
+			break
+		}
+	}
+
+	if javaHome := os.Getenv("JAVA_HOME"); javaHome != "" {
+		if match := javaReleaseVersionPattern.FindStringSubmatch(readFile(filepath.Join(javaHome, "release"))); match != nil {
+			jdkVersion = match[1]
+		}
+	}
+
+	for _, missing := range [][2]string{{"Gradle", gradleVersion}, {"Android Gradle Plugin", agpVer}, {"JDK", jdkVersion}} {
+		if missing[1] == "" {
+			logger.Warnf("Failed to read the %s version", missing[0])
+		}
+	}
+	return
+}
+
+func gitCommit(projectLocation string) string {
+	commit, err := cmdFactory.Create("git", []string{"rev-parse", "HEAD"}, &command.Opts{Dir: projectLocation}).RunAndReturnTrimmedOutput()
+	if err != nil {
+		return ""
+	}
+	return commit
+}
+
+// provenanceStepVersion returns the version set at build time, or the module version of the build info
+// (if the step is built with go install <module>@<version>).
+func provenanceStepVersion() string {
+	if stepVersion != "unknown" {
+		return stepVersion
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return stepVersion
+}
+
+// checksumsContent lists the artifact checksums in the format of sha256sum, they can be verified with:
+// sha256sum -c apk-checksums.txt
+func checksumsContent(artifacts []provenanceArtifact) string {
+	var b strings.Builder
+	for _, artifact := range artifacts {
+		fmt.Fprintf(&b, "%s  %s\n", artifact.SHA256, artifact.Name)
+	}
+	return b.String()
+}
+
+// exportProvenance writes the checksums and the provenance record into the deploy dir.
+func exportProvenance(record provenance, deployDir, collisionPolicy string) (checksumsPth string, provenancePth string, err error) {
+	if checksumsPth, err = writeDeployFile(deployDir, checksumsFileName, []byte(checksumsContent(record.Artifacts)), collisionPolicy); err != nil {
+		return "", "", err
+	}
+
+	content, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return "", "", err
+	}
+	if provenancePth, err = writeDeployFile(deployDir, provenanceFileName, content, collisionPolicy); err != nil {
+		return "", "", err
+	}
+	return checksumsPth, provenancePth, nil
+}
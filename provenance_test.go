@@ -0,0 +1,72 @@
+package main
+
+import "testing"
+
+func Test_wrapperGradleVersion(t *testing.T) {
+	properties := `distributionBase=GRADLE_USER_HOME
+distributionUrl=https\://services.gradle.org/distributions/gradle-8.7-bin.zip
+zipStorePath=wrapper/dists`
+	if got := wrapperGradleVersion(properties); got != "8.7" {
+		t.Errorf("wrapperGradleVersion() = %v, want 8.7", got)
+	}
+	if got := wrapperGradleVersion("distributionUrl=https\\://example.com/gradle-8.10.2-all.zip"); got != "8.10.2" {
+		t.Errorf("wrapperGradleVersion() = %v, want 8.10.2", got)
+	}
+}
+
+func Test_agpVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "buildscript classpath", content: "dependencies { classpath 'com.android.tools.build:gradle:8.4.0' }", want: "8.4.0"},
+		{name: "plugins block", content: `plugins { id("com.android.application") version "8.3.1" apply false }`, want: "8.3.1"},
+		{name: "catalog version ref", content: `[versions]
+agp = "8.5.0"
+
+[plugins]
+android-application = { id = "com.android.application", version.ref = "agp" }`, want: "8.5.0"},
+		{name: "catalog library version", content: `[libraries]
+android-gradle = { module = "com.android.tools.build:gradle", version = "8.2.2" }`, want: "8.2.2"},
+		{name: "no AGP", content: `plugins { id("org.jetbrains.kotlin.jvm") version "1.9.0" }`, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := agpVersion(tt.content); got != tt.want {
+				t.Errorf("agpVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_checksumsContent(t *testing.T) {
+	artifacts := []provenanceArtifact{
+		{Name: "app-debug.apk", SHA256: "a172cedcae47474b615c54d510a5d84a8dea3032e958587430b413538be3f333"},
+		{Name: "app-debug-androidTest.apk", SHA256: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"},
+	}
+	want := `a172cedcae47474b615c54d510a5d84a8dea3032e958587430b413538be3f333  app-debug.apk
+9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08  app-debug-androidTest.apk
+`
+	if got := checksumsContent(artifacts); got != want {
+		t.Errorf("checksumsContent() = %s, want %s", got, want)
+	}
+}
+
+func Test_provenanceStepVersion(t *testing.T) {
+	original := stepVersion
+	defer func() {
+		stepVersion = original
+	}()
+
+	stepVersion = "2.3.1"
+	if got := provenanceStepVersion(); got != "2.3.1" {
+		t.Errorf("provenanceStepVersion() = %v, want 2.3.1", got)
+	}
+
+	// Test binaries have no module version in their build info.
+	stepVersion = "unknown"
+	if got := provenanceStepVersion(); got != "unknown" {
+		t.Errorf("provenanceStepVersion() = %v, want unknown", got)
+	}
+}
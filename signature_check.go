@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bitrise-steplib/bitrise-step-android-build-for-ui-testing/apk"
+)
+
+const (
+	signatureCheckFail = "fail"
+	signatureCheckWarn = "warn"
+)
+
+// signatureComparison is the result of comparing the signer certificates of the app and test APKs.
+type signatureComparison struct {
+	Scheme            string
+	AppFingerprints   []string
+	TestFingerprints  []string
+	CertificatesMatch bool
+}
+
+// compareSignatures compares the signer certificates of the newest signature scheme both APKs are signed with.
+// The package manager verifies the APKs with their newest scheme, the app and the test APK can only share
+// a signature (required by the instrumentation) if these certificates match.
+func compareSignatures(appSignatures, testSignatures apk.Signatures) (signatureComparison, error) {
+	if len(appSignatures) == 0 {
+		return signatureComparison{}, fmt.Errorf("the app APK is not signed")
+	}
+	if len(testSignatures) == 0 {
+		return signatureComparison{}, fmt.Errorf("the test APK is not signed")
+	}
+
+	for _, scheme := range apk.Schemes {
+		if len(appSignatures[scheme]) == 0 || len(testSignatures[scheme]) == 0 {
+			continue
+		}
+
+		appFingerprints := appSignatures.Fingerprints(scheme)
+		testFingerprints := testSignatures.Fingerprints(scheme)
+		return signatureComparison{
+			Scheme:            scheme,
+			AppFingerprints:   appFingerprints,
+			TestFingerprints:  testFingerprints,
+			CertificatesMatch: strings.Join(appFingerprints, ",") == strings.Join(testFingerprints, ","),
+		}, nil
+	}
+
+	return signatureComparison{}, fmt.Errorf("the app APK (%s) and the test APK (%s) are not signed with a common signature scheme", signedSchemes(appSignatures), signedSchemes(testSignatures))
+}
+
+func signedSchemes(signatures apk.Signatures) string {
+	var schemes []string
+	for _, scheme := range apk.Schemes {
+		if len(signatures[scheme]) > 0 {
+			schemes = append(schemes, scheme)
+		}
+	}
+	return strings.Join(schemes, ", ")
+}
+
+// checkSignatures reads and compares the signer certificates of the app and test APKs.
+func checkSignatures(appPth, testPth string) (signatureComparison, error) {
+	appSignatures, err := apk.ReadSignatures(appPth)
+	if err != nil {
+		return signatureComparison{}, fmt.Errorf("failed to read the app APK signatures: %v", err)
+	}
+	testSignatures, err := apk.ReadSignatures(testPth)
+	if err != nil {
+		return signatureComparison{}, fmt.Errorf("failed to read the test APK signatures: %v", err)
+	}
+	return compareSignatures(appSignatures, testSignatures)
+}
+
+func printSignatureComparison(comparison signatureComparison) {
+	logger.Printf("  Signature scheme: %s", comparison.Scheme)
+	logger.Printf("  App APK signer SHA-256:  %s", strings.Join(comparison.AppFingerprints, ", "))
+	logger.Printf("  Test APK signer SHA-256: %s", strings.Join(comparison.TestFingerprints, ", "))
+}
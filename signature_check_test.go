@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/x509"
+	"reflect"
+	"testing"
+
+	"github.com/bitrise-steplib/bitrise-step-android-build-for-ui-testing/apk"
+)
+
+func Test_compareSignatures(t *testing.T) {
+	debugKey := apk.Signer{Certificate: &x509.Certificate{Raw: []byte("debug")}}
+	releaseKey := apk.Signer{Certificate: &x509.Certificate{Raw: []byte("release")}}
+
+	tests := []struct {
+		name    string
+		app     apk.Signatures
+		test    apk.Signatures
+		want    signatureComparison
+		wantErr bool
+	}{
+		{
+			name: "same certificate",
+			app:  apk.Signatures{apk.SchemeV2: {debugKey}, apk.SchemeV1: {debugKey}},
+			test: apk.Signatures{apk.SchemeV2: {debugKey}, apk.SchemeV1: {debugKey}},
+			want: signatureComparison{
+				Scheme:            apk.SchemeV2,
+				AppFingerprints:   []string{debugKey.Fingerprint()},
+				TestFingerprints:  []string{debugKey.Fingerprint()},
+				CertificatesMatch: true,
+			},
+		},
+		{
+			name: "different certificates",
+			app:  apk.Signatures{apk.SchemeV3: {releaseKey}, apk.SchemeV2: {releaseKey}},
+			test: apk.Signatures{apk.SchemeV2: {debugKey}},
+			want: signatureComparison{
+				Scheme:            apk.SchemeV2,
+				AppFingerprints:   []string{releaseKey.Fingerprint()},
+				TestFingerprints:  []string{debugKey.Fingerprint()},
+				CertificatesMatch: false,
+			},
+		},
+		{
+			name:    "no common scheme",
+			app:     apk.Signatures{apk.SchemeV2: {debugKey}},
+			test:    apk.Signatures{apk.SchemeV1: {debugKey}},
+			wantErr: true,
+		},
+		{
+			name:    "unsigned test APK",
+			app:     apk.Signatures{apk.SchemeV2: {debugKey}},
+			test:    apk.Signatures{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := compareSignatures(tt.app, tt.test)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("compareSignatures() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("compareSignatures() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/command"
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+const (
+	keystorePasswordEnvKey   = "APKSIGNER_KEYSTORE_PASSWORD"
+	privateKeyPasswordEnvKey = "APKSIGNER_PRIVATE_KEY_PASSWORD"
+
+	signerSchemeAutomatic = "automatic"
+)
+
+// signingConfig describes the key the exported APKs are signed with.
+type signingConfig struct {
+	KeystorePath       string
+	KeystorePassword   string
+	Alias              string
+	PrivateKeyPassword string
+	Scheme             string
+}
+
+func (c signingConfig) validate() error {
+	if c.KeystorePassword == "" {
+		return fmt.Errorf("keystore password is not set")
+	}
+	if c.Alias == "" {
+		return fmt.Errorf("keystore alias is not set")
+	}
+	return nil
+}
+
+// findAPKSigner returns the path of the apksigner tool from the latest build-tools of the Android SDK.
+func findAPKSigner(androidHome string) (string, error) {
+	if androidHome == "" {
+		return "", fmt.Errorf("ANDROID_HOME is not set")
+	}
+
+	buildToolsDir, err := latestBuildToolsDir(filepath.Join(androidHome, "build-tools"))
+	if err != nil {
+		return "", err
+	}
+
+	apksigner := filepath.Join(buildToolsDir, "apksigner")
+	if exists, err := pathutil.IsPathExists(apksigner); err != nil {
+		return "", err
+	} else if !exists {
+		return "", fmt.Errorf("apksigner not found at: %s", apksigner)
+	}
+	return apksigner, nil
+}
+
+func latestBuildToolsDir(buildToolsDir string) (string, error) {
+	entries, err := ioutil.ReadDir(buildToolsDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to list build-tools: %v", err)
+	}
+
+	var latest string
+	var latestVersion []int
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		version, ok := parseVersion(entry.Name())
+		if !ok {
+			continue
+		}
+		if latestVersion == nil || compareVersions(version, latestVersion) > 0 {
+			latest = entry.Name()
+			latestVersion = version
+		}
+	}
+
+	if latest == "" {
+		return "", fmt.Errorf("no build-tools found in: %s", buildToolsDir)
+	}
+	return filepath.Join(buildToolsDir, latest), nil
+}
+
+// parseVersion parses version names, like: 30.0.3, 34.0.0-rc1 (build-tools directories), 1.4.2 (Maven artifacts)
+func parseVersion(name string) ([]int, bool) {
+	name = strings.SplitN(name, "-", 2)[0]
+
+	var version []int
+	for _, component := range strings.Split(name, ".") {
+		n, err := strconv.Atoi(component)
+		if err != nil {
+			return nil, false
+		}
+		version = append(version, n)
+	}
+	return version, true
+}
+
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x > y {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
+// signerSchemeArgs returns the apksigner arguments enabling only the selected signature scheme.
+// With the automatic scheme apksigner decides based on the APK's minSdkVersion.
+func signerSchemeArgs(scheme string) []string {
+	if scheme == "" || scheme == signerSchemeAutomatic {
+		return nil
+	}
+
+	var args []string
+	for _, s := range []string{"v1", "v2", "v3"} {
+		args = append(args, fmt.Sprintf("--%s-signing-enabled", s), strconv.FormatBool(s == scheme))
+	}
+	return args
+}
+
+// signAPK signs the APK in place. The passwords are passed in environment variables,
+// so that they do not appear in the printed command.
+func signAPK(apksigner string, config signingConfig, apkPth string) error {
+	keyPassword := config.PrivateKeyPassword
+	if keyPassword == "" {
+		keyPassword = config.KeystorePassword
+	}
+
+	args := []string{"sign",
+		"--ks", config.KeystorePath,
+		"--ks-key-alias", config.Alias,
+		"--ks-pass", "env:" + keystorePasswordEnvKey,
+		"--key-pass", "env:" + privateKeyPasswordEnvKey,
+	}
+	args = append(args, signerSchemeArgs(config.Scheme)...)
+	args = append(args, apkPth)
+
+	cmd := cmdFactory.Create(apksigner, args, &command.Opts{
+		Env: []string{
+			keystorePasswordEnvKey + "=" + config.KeystorePassword,
+			privateKeyPasswordEnvKey + "=" + keyPassword,
+		},
+	})
+	logger.Donef("$ %s", cmd.PrintableCommandArgs())
+	if out, err := cmd.RunAndReturnTrimmedCombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %s, %v", filepath.Base(apksigner), out, err)
+	}
+	return nil
+}
+
+func verifyAPKSignature(apksigner, apkPth string) error {
+	cmd := cmdFactory.Create(apksigner, []string{"verify", "--verbose", apkPth}, nil)
+	logger.Donef("$ %s", cmd.PrintableCommandArgs())
+	out, err := cmd.RunAndReturnTrimmedCombinedOutput()
+	if err != nil {
+		return fmt.Errorf("signature verification failed: %s, %v", out, err)
+	}
+	logger.Printf("%s", out)
+	return nil
+}
+
+// signArtifacts signs the given APKs with the same key and verifies the signatures.
+func signArtifacts(config signingConfig, apkPths ...string) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+
+	apksigner, err := findAPKSigner(androidHome())
+	if err != nil {
+		return err
+	}
+
+	for _, pth := range apkPths {
+		if err := signAPK(apksigner, config, pth); err != nil {
+			return fmt.Errorf("failed to sign %s: %v", filepath.Base(pth), err)
+		}
+		if err := verifyAPKSignature(apksigner, pth); err != nil {
+			return fmt.Errorf("failed to verify %s: %v", filepath.Base(pth), err)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func androidHome() string {
+	if pth := os.Getenv("ANDROID_HOME"); pth != "" {
+		return pth
+	}
+	return os.Getenv("ANDROID_SDK_ROOT")
+}
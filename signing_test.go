@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_latestBuildToolsDir(t *testing.T) {
+	buildToolsDir := t.TempDir()
+	for _, name := range []string{"28.0.3", "30.0.3", "30.0.10", "34.0.0-rc1", "not-a-version"} {
+		if err := os.MkdirAll(filepath.Join(buildToolsDir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := latestBuildToolsDir(buildToolsDir)
+	if err != nil {
+		t.Fatalf("latestBuildToolsDir() error = %v", err)
+	}
+	if want := filepath.Join(buildToolsDir, "34.0.0-rc1"); got != want {
+		t.Errorf("latestBuildToolsDir() = %s, want %s", got, want)
+	}
+
+	if _, err := latestBuildToolsDir(t.TempDir()); err == nil {
+		t.Errorf("latestBuildToolsDir() expected error for empty build-tools dir")
+	}
+}
+
+func Test_signerSchemeArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		scheme string
+		want   []string
+	}{
+		{
+			name:   "automatic",
+			scheme: "automatic",
+			want:   nil,
+		},
+		{
+			name:   "v1 only",
+			scheme: "v1",
+			want:   []string{"--v1-signing-enabled", "true", "--v2-signing-enabled", "false", "--v3-signing-enabled", "false"},
+		},
+		{
+			name:   "v3 only",
+			scheme: "v3",
+			want:   []string{"--v1-signing-enabled", "false", "--v2-signing-enabled", "false", "--v3-signing-enabled", "true"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := signerSchemeArgs(tt.scheme); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("signerSchemeArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-steputils/tools"
+	"github.com/bitrise-steplib/bitrise-step-android-build-for-ui-testing/apk"
+)
+
+const (
+	sizeDiffEnvKey         = "BITRISE_APK_SIZE_DIFF_PATH"
+	sizeDiffMarkdownEnvKey = "BITRISE_APK_SIZE_DIFF_MARKDOWN_PATH"
+	sizeDiffFileName       = "apk-size-diff.json"
+	sizeDiffMarkdownName   = "apk-size-diff.md"
+)
+
+// Content categories of the size diff.
+const (
+	dexCategory             = "dex"
+	resourcesCategory       = "resources"
+	nativeLibrariesCategory = "native libraries"
+	assetsCategory          = "assets"
+	otherCategory           = "other"
+)
+
+var sizeDiffCategories = []string{dexCategory, resourcesCategory, nativeLibrariesCategory, assetsCategory, otherCategory}
+
+// apkSizeDiff compares an exported APK with its baseline, the size deltas are compressed sizes.
+type apkSizeDiff struct {
+	Role                  string         `json:"role"`
+	Name                  string         `json:"name"`
+	BaselineName          string         `json:"baseline_name"`
+	SizeDelta             int64          `json:"size_delta"`
+	MethodReferencesDelta int            `json:"method_references_delta"`
+	Categories            []categoryDiff `json:"categories"`
+	AddedClasses          []string       `json:"added_classes"`
+	RemovedClasses        []string       `json:"removed_classes"`
+}
+
+type categoryDiff struct {
+	Category  string     `json:"category"`
+	SizeDelta int64      `json:"size_delta"`
+	Added     []fileDiff `json:"added"`
+	Removed   []fileDiff `json:"removed"`
+	Changed   []fileDiff `json:"changed"`
+}
+
+// fileDiff is a changed APK entry, the additions over the threshold are highlighted.
+type fileDiff struct {
+	Name        string `json:"name"`
+	SizeDelta   int64  `json:"size_delta"`
+	Highlighted bool   `json:"highlighted"`
+}
+
+func contentCategory(name string) string {
+	// The name is an entry, or a top-level directory (like res) of a size report baseline.
+	top := strings.SplitN(name, "/", 2)[0]
+	switch {
+	case apk.IsDexEntry(name):
+		return dexCategory
+	case top == "res" || name == "resources.arsc":
+		return resourcesCategory
+	case top == "lib":
+		return nativeLibrariesCategory
+	case top == "assets":
+		return assetsCategory
+	default:
+		return otherCategory
+	}
+}
+
+// loadBaselineReports reads the baseline size reports by APK role, from a previously exported size report
+// or from a directory of previously built APKs.
+func loadBaselineReports(pth string) (map[string]apkSizeReport, error) {
+	info, err := os.Stat(pth)
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []apkSizeReport
+	if info.IsDir() {
+		apkPths, err := filepath.Glob(filepath.Join(pth, "*.apk"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(apkPths)
+
+		// The APKs may be renamed by the artifact name template, the test APK is the one declaring an <instrumentation>.
+		var appPth, testPth string
+		for _, apkPth := range apkPths {
+			manifest, err := apk.ReadManifest(apkPth)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read the manifest of %s: %v", apkPth, err)
+			}
+			if len(manifest.Instrumentations) > 0 && testPth == "" {
+				testPth = apkPth
+			} else if len(manifest.Instrumentations) == 0 && appPth == "" {
+				appPth = apkPth
+			}
+		}
+		// The baseline of a library module only has a test APK.
+		if testPth == "" {
+			return nil, fmt.Errorf("no test APK found in %s", pth)
+		}
+		if reports, err = analyzeAPKSizes(appPth, testPth); err != nil {
+			return nil, err
+		}
+	} else {
+		content, err := ioutil.ReadFile(pth)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(content, &reports); err != nil {
+			return nil, fmt.Errorf("invalid size report %s: %v", pth, err)
+		}
+	}
+
+	byRole := map[string]apkSizeReport{}
+	for _, report := range reports {
+		byRole[report.Role] = report
+	}
+	return byRole, nil
+}
+
+// diffSizeReports compares the APK with the baseline, highlighting the additions of at least the threshold bytes.
+// A baseline read from an exported size report has no files and classes, it is compared by the top-level entries.
+func diffSizeReports(report, baseline apkSizeReport, threshold int64) apkSizeDiff {
+	diff := apkSizeDiff{
+		Role:                  report.Role,
+		Name:                  report.Name,
+		BaselineName:          baseline.Name,
+		SizeDelta:             report.Size - baseline.Size,
+		MethodReferencesDelta: report.MethodReferences - baseline.MethodReferences,
+	}
+
+	files, baselineEntries := report.Files, baseline.Files
+	if len(baseline.Files) == 0 {
+		files, baselineEntries = report.Entries, baseline.Entries
+	} else {
+		diff.AddedClasses = missingFrom(report.Classes, baseline.Classes)
+		diff.RemovedClasses = missingFrom(baseline.Classes, report.Classes)
+	}
+
+	highlight := func(delta int64) bool {
+		return threshold > 0 && delta >= threshold
+	}
+
+	baselineFiles := map[string]apk.EntrySize{}
+	for _, f := range baselineEntries {
+		baselineFiles[f.Name] = f
+	}
+	categories := map[string]*categoryDiff{}
+	for _, category := range sizeDiffCategories {
+		categories[category] = &categoryDiff{Category: category}
+	}
+
+	for _, f := range files {
+		category := categories[contentCategory(f.Name)]
+		baselineFile, ok := baselineFiles[f.Name]
+		delete(baselineFiles, f.Name)
+
+		delta := int64(f.CompressedSize) - int64(baselineFile.CompressedSize)
+		category.SizeDelta += delta
+		if !ok {
+			category.Added = append(category.Added, fileDiff{Name: f.Name, SizeDelta: delta, Highlighted: highlight(delta)})
+		} else if f.CompressedSize != baselineFile.CompressedSize || f.UncompressedSize != baselineFile.UncompressedSize {
+			category.Changed = append(category.Changed, fileDiff{Name: f.Name, SizeDelta: delta, Highlighted: highlight(delta)})
+		}
+	}
+	for _, f := range baselineEntries {
+		if _, ok := baselineFiles[f.Name]; !ok {
+			continue
+		}
+		category := categories[contentCategory(f.Name)]
+		category.SizeDelta -= int64(f.CompressedSize)
+		category.Removed = append(category.Removed, fileDiff{Name: f.Name, SizeDelta: -int64(f.CompressedSize)})
+	}
+
+	for _, category := range sizeDiffCategories {
+		diff.Categories = append(diff.Categories, *categories[category])
+	}
+	return diff
+}
+
+// missingFrom returns the sorted items of a which are not in b.
+func missingFrom(a, b []string) []string {
+	inB := map[string]bool{}
+	for _, item := range b {
+		inB[item] = true
+	}
+	var missing []string
+	for _, item := range a {
+		if !inB[item] {
+			missing = append(missing, item)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+func formatSizeDelta(delta int64) string {
+	if delta < 0 {
+		return "-" + formatSize(uint64(-delta))
+	}
+	return "+" + formatSize(uint64(delta))
+}
+
+func sizeDiffMarkdown(diffs []apkSizeDiff) string {
+	var b strings.Builder
+	b.WriteString("# APK size diff\n")
+	for _, diff := range diffs {
+		fmt.Fprintf(&b, "\n## %s APK: %s (baseline: %s)\n\n", strings.ToUpper(diff.Role[:1])+diff.Role[1:], diff.Name, diff.BaselineName)
+		fmt.Fprintf(&b, "Size: %s, method references: %+d, classes: %d added, %d removed\n", formatSizeDelta(diff.SizeDelta), diff.MethodReferencesDelta, len(diff.AddedClasses), len(diff.RemovedClasses))
+
+		b.WriteString("\n| Category | Size | Added | Removed | Changed |\n| --- | ---: | ---: | ---: | ---: |\n")
+		for _, category := range diff.Categories {
+			fmt.Fprintf(&b, "| %s | %s | %d | %d | %d |\n", category.Category, formatSizeDelta(category.SizeDelta), len(category.Added), len(category.Removed), len(category.Changed))
+		}
+
+		var highlighted []fileDiff
+		for _, category := range diff.Categories {
+			for _, f := range append(append([]fileDiff{}, category.Added...), category.Changed...) {
+				if f.Highlighted {
+					highlighted = append(highlighted, f)
+				}
+			}
+		}
+		if len(highlighted) > 0 {
+			b.WriteString("\n**Additions over the threshold:**\n\n")
+			for _, f := range highlighted {
+				fmt.Fprintf(&b, "- `%s`: %s\n", f.Name, formatSizeDelta(f.SizeDelta))
+			}
+		}
+
+		if len(diff.AddedClasses) > 0 {
+			b.WriteString("\n<details><summary>Added classes</summary>\n\n")
+			for _, class := range diff.AddedClasses {
+				fmt.Fprintf(&b, "- `%s`\n", class)
+			}
+			b.WriteString("\n</details>\n")
+		}
+		if len(diff.RemovedClasses) > 0 {
+			b.WriteString("\n<details><summary>Removed classes</summary>\n\n")
+			for _, class := range diff.RemovedClasses {
+				fmt.Fprintf(&b, "- `%s`\n", class)
+			}
+			b.WriteString("\n</details>\n")
+		}
+	}
+	return b.String()
+}
+
+func printSizeDiffs(diffs []apkSizeDiff) {
+	for _, diff := range diffs {
+		logger.Printf("  %s: %s, %+d method references, %d classes added, %d removed", diff.Name, formatSizeDelta(diff.SizeDelta), diff.MethodReferencesDelta, len(diff.AddedClasses), len(diff.RemovedClasses))
+		for _, category := range diff.Categories {
+			for _, f := range append(append([]fileDiff{}, category.Added...), category.Changed...) {
+				if f.Highlighted {
+					logger.Warnf("  %s: %s", f.Name, formatSizeDelta(f.SizeDelta))
+				}
+			}
+		}
+	}
+}
+
+// compareWithBaseline diffs the size reports against the baseline and exports the diff reports.
+func compareWithBaseline(reports []apkSizeReport, baselinePth string, threshold int64, deployDir, collisionPolicy string) error {
+	baselines, err := loadBaselineReports(baselinePth)
+	if err != nil {
+		return fmt.Errorf("failed to load the baseline: %v", err)
+	}
+
+	var diffs []apkSizeDiff
+	for _, report := range reports {
+		baseline, ok := baselines[report.Role]
+		if !ok {
+			logger.Warnf("  No %s APK found in the baseline", report.Role)
+			continue
+		}
+		diffs = append(diffs, diffSizeReports(report, baseline, threshold))
+	}
+
+	fmt.Println()
+	logger.Infof("APK size diff:")
+	printSizeDiffs(diffs)
+
+	jsonPth, markdownPth, err := exportSizeDiffs(diffs, deployDir, collisionPolicy)
+	if err != nil {
+		return err
+	}
+	for _, env := range [][2]string{{sizeDiffEnvKey, jsonPth}, {sizeDiffMarkdownEnvKey, markdownPth}} {
+		if err := tools.ExportEnvironmentWithEnvman(env[0], env[1]); err != nil {
+			return fmt.Errorf("failed to export environment variable: %s", env[0])
+		}
+		logger.Printf("  Env    [ $%s = $BITRISE_DEPLOY_DIR/%s ]", env[0], filepath.Base(env[1]))
+	}
+	return nil
+}
+
+// exportSizeDiffs writes the JSON and the markdown size diff reports into the deploy dir.
+func exportSizeDiffs(diffs []apkSizeDiff, deployDir, collisionPolicy string) (jsonPth string, markdownPth string, err error) {
+	content, err := json.MarshalIndent(diffs, "", "  ")
+	if err != nil {
+		return "", "", err
+	}
+	if jsonPth, err = writeDeployFile(deployDir, sizeDiffFileName, content, collisionPolicy); err != nil {
+		return "", "", err
+	}
+	if markdownPth, err = writeDeployFile(deployDir, sizeDiffMarkdownName, []byte(sizeDiffMarkdown(diffs)), collisionPolicy); err != nil {
+		return "", "", err
+	}
+	return jsonPth, markdownPth, nil
+}
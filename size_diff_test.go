@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bitrise-steplib/bitrise-step-android-build-for-ui-testing/apk"
+)
+
+func Test_diffSizeReports(t *testing.T) {
+	baseline := apkSizeReport{
+		Name: "app-debug-androidTest.apk",
+		Role: testBundleRoleTest,
+		SizeReport: apk.SizeReport{
+			Size:             1000,
+			MethodReferences: 100,
+			Files: []apk.EntrySize{
+				{Name: "classes.dex", CompressedSize: 500, UncompressedSize: 900},
+				{Name: "res/raw/old.json", CompressedSize: 100, UncompressedSize: 100},
+				{Name: "AndroidManifest.xml", CompressedSize: 10, UncompressedSize: 30},
+			},
+			Classes: []string{"com.example.LoginTest", "com.example.OldTest"},
+		},
+	}
+	report := apkSizeReport{
+		Name: "app-debug-androidTest.apk",
+		Role: testBundleRoleTest,
+		SizeReport: apk.SizeReport{
+			Size:             400000,
+			MethodReferences: 40100,
+			Files: []apk.EntrySize{
+				{Name: "classes.dex", CompressedSize: 600, UncompressedSize: 1100},
+				{Name: "classes2.dex", CompressedSize: 300000, UncompressedSize: 600000},
+				{Name: "lib/x86_64/libmock.so", CompressedSize: 50, UncompressedSize: 80},
+				{Name: "AndroidManifest.xml", CompressedSize: 10, UncompressedSize: 30},
+			},
+			Classes: []string{"com.example.LoginTest", "io.mockk.MockK", "com.example.ProfileTest"},
+		},
+	}
+
+	got := diffSizeReports(report, baseline, 100*1024)
+
+	if got.SizeDelta != 399000 || got.MethodReferencesDelta != 40000 {
+		t.Errorf("diffSizeReports() deltas = %d bytes, %d methods", got.SizeDelta, got.MethodReferencesDelta)
+	}
+	if want := []string{"com.example.ProfileTest", "io.mockk.MockK"}; !reflect.DeepEqual(got.AddedClasses, want) {
+		t.Errorf("diffSizeReports() added classes = %v, want %v", got.AddedClasses, want)
+	}
+	if want := []string{"com.example.OldTest"}; !reflect.DeepEqual(got.RemovedClasses, want) {
+		t.Errorf("diffSizeReports() removed classes = %v, want %v", got.RemovedClasses, want)
+	}
+
+	want := []categoryDiff{
+		{
+			Category:  dexCategory,
+			SizeDelta: 300100,
+			Added:     []fileDiff{{Name: "classes2.dex", SizeDelta: 300000, Highlighted: true}},
+			Changed:   []fileDiff{{Name: "classes.dex", SizeDelta: 100}},
+		},
+		{
+			Category:  resourcesCategory,
+			SizeDelta: -100,
+			Removed:   []fileDiff{{Name: "res/raw/old.json", SizeDelta: -100}},
+		},
+		{
+			Category:  nativeLibrariesCategory,
+			SizeDelta: 50,
+			Added:     []fileDiff{{Name: "lib/x86_64/libmock.so", SizeDelta: 50}},
+		},
+		{Category: assetsCategory},
+		{Category: otherCategory},
+	}
+	if !reflect.DeepEqual(got.Categories, want) {
+		t.Errorf("diffSizeReports() categories = %+v, want %+v", got.Categories, want)
+	}
+}
+
+func Test_loadBaselineReports_sizeReport(t *testing.T) {
+	reports := []apkSizeReport{
+		{Name: "app-debug.apk", Role: testBundleRoleApp, SizeReport: apk.SizeReport{Size: 10}},
+		{Name: "app-debug-androidTest.apk", Role: testBundleRoleTest, SizeReport: apk.SizeReport{Size: 20}},
+	}
+	content, err := json.Marshal(reports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pth := filepath.Join(t.TempDir(), sizeReportFileName)
+	if err := ioutil.WriteFile(pth, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := loadBaselineReports(pth)
+	if err != nil {
+		t.Fatalf("loadBaselineReports() error = %v", err)
+	}
+	if got[testBundleRoleApp].Size != 10 || got[testBundleRoleTest].Size != 20 {
+		t.Errorf("loadBaselineReports() = %+v", got)
+	}
+}
+
+func Test_diffSizeReports_sizeReportBaseline(t *testing.T) {
+	report := apkSizeReport{Name: "app-debug.apk", Role: testBundleRoleApp, SizeReport: apk.SizeReport{
+		Size:    300,
+		Entries: []apk.EntrySize{{Name: "res", CompressedSize: 150}, {Name: "classes.dex", CompressedSize: 100}},
+		Files:   []apk.EntrySize{{Name: "res/a.xml", CompressedSize: 150}, {Name: "classes.dex", CompressedSize: 100}},
+		Classes: []string{"Lcom/example/A;"},
+	}}
+	// The exported size report has the top-level entries only.
+	baseline := apkSizeReport{Name: "app-debug.apk", Role: testBundleRoleApp, SizeReport: apk.SizeReport{
+		Size:    200,
+		Entries: []apk.EntrySize{{Name: "res", CompressedSize: 100}, {Name: "classes.dex", CompressedSize: 100}},
+	}}
+
+	got := diffSizeReports(report, baseline, 0)
+	if got.SizeDelta != 100 || got.AddedClasses != nil || got.RemovedClasses != nil {
+		t.Errorf("diffSizeReports() = %+v", got)
+	}
+	for _, category := range got.Categories {
+		want := categoryDiff{Category: category.Category}
+		if category.Category == resourcesCategory {
+			want = categoryDiff{Category: resourcesCategory, SizeDelta: 50, Changed: []fileDiff{{Name: "res", SizeDelta: 50}}}
+		}
+		if !reflect.DeepEqual(category, want) {
+			t.Errorf("diffSizeReports() category = %+v, want %+v", category, want)
+		}
+	}
+}
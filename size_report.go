@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/go-steputils/tools"
+	"github.com/bitrise-steplib/bitrise-step-android-build-for-ui-testing/apk"
+)
+
+const (
+	sizeReportEnvKey         = "BITRISE_APK_SIZE_REPORT_PATH"
+	sizeReportMarkdownEnvKey = "BITRISE_APK_SIZE_REPORT_MARKDOWN_PATH"
+	sizeReportFileName       = "apk-size-report.json"
+	sizeReportMarkdownName   = "apk-size-report.md"
+	// dexMethodLimit is the maximum number of methods a single DEX file can reference.
+	dexMethodLimit = 65536
+)
+
+// apkSizeReport is the size report of an exported APK.
+type apkSizeReport struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+	apk.SizeReport
+}
+
+// sizeThresholds are the limits the exported APKs must not exceed, zero values disable the checks.
+type sizeThresholds struct {
+	MaxSizeMB      int
+	MaxMethodCount int
+}
+
+func (t sizeThresholds) enabled() bool {
+	return t.MaxSizeMB > 0 || t.MaxMethodCount > 0
+}
+
+// analyzeAPKSizes analyzes the app and the test APKs, the app APK is skipped if its path is empty (library modules).
+func analyzeAPKSizes(appPth, testPth string) ([]apkSizeReport, error) {
+	var reports []apkSizeReport
+	for _, a := range [][2]string{{appPth, testBundleRoleApp}, {testPth, testBundleRoleTest}} {
+		if a[0] == "" {
+			continue
+		}
+		report, err := apk.AnalyzeSize(a[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to analyze %s: %v", filepath.Base(a[0]), err)
+		}
+		reports = append(reports, apkSizeReport{Name: filepath.Base(a[0]), Role: a[1], SizeReport: report})
+	}
+	return reports, nil
+}
+
+// checkSizeThresholds returns the violations of the thresholds.
+func checkSizeThresholds(reports []apkSizeReport, thresholds sizeThresholds) []string {
+	var violations []string
+	for _, report := range reports {
+		if thresholds.MaxSizeMB > 0 && report.Size > int64(thresholds.MaxSizeMB)*1024*1024 {
+			violations = append(violations, fmt.Sprintf("the %s APK (%s) is %s, larger than %d MB", report.Role, report.Name, formatSize(uint64(report.Size)), thresholds.MaxSizeMB))
+		}
+		if thresholds.MaxMethodCount > 0 && report.MethodReferences > thresholds.MaxMethodCount {
+			violations = append(violations, fmt.Sprintf("the %s APK (%s) references %d methods, more than %d", report.Role, report.Name, report.MethodReferences, thresholds.MaxMethodCount))
+		}
+	}
+	return violations
+}
+
+func formatSize(size uint64) string {
+	switch {
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.2f MB", float64(size)/(1024*1024))
+	case size >= 1024:
+		return fmt.Sprintf("%.2f KB", float64(size)/1024)
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
+
+func sizeReportMarkdown(reports []apkSizeReport) string {
+	var b strings.Builder
+	b.WriteString("# APK size report\n")
+	for _, report := range reports {
+		fmt.Fprintf(&b, "\n## %s APK: %s\n\n", strings.ToUpper(report.Role[:1])+report.Role[1:], report.Name)
+		fmt.Fprintf(&b, "Size: %s, DEX files: %d, method references: %d, field references: %d\n", formatSize(uint64(report.Size)), len(report.DexFiles), report.MethodReferences, report.FieldReferences)
+
+		b.WriteString("\n| Entry | Compressed | Uncompressed |\n| --- | ---: | ---: |\n")
+		for _, entry := range report.Entries {
+			fmt.Fprintf(&b, "| `%s` | %s | %s |\n", entry.Name, formatSize(entry.CompressedSize), formatSize(entry.UncompressedSize))
+		}
+
+		b.WriteString("\n| DEX file | Method references | Field references |\n| --- | ---: | ---: |\n")
+		for _, dex := range report.DexFiles {
+			fmt.Fprintf(&b, "| `%s` | %d | %d |\n", dex.Name, dex.MethodReferences, dex.FieldReferences)
+		}
+	}
+	return b.String()
+}
+
+func printSizeReports(reports []apkSizeReport) {
+	for _, report := range reports {
+		logger.Printf("  %s: %s, %d DEX file(s), %d method and %d field references", report.Name, formatSize(uint64(report.Size)), len(report.DexFiles), report.MethodReferences, report.FieldReferences)
+		for _, dex := range report.DexFiles {
+			if dex.MethodReferences > dexMethodLimit*9/10 {
+				logger.Warnf("  %s references %d methods, close to the %d limit of a DEX file", dex.Name, dex.MethodReferences, dexMethodLimit)
+			}
+		}
+	}
+}
+
+// exportSizeReports writes the JSON and the markdown size reports into the deploy dir.
+func exportSizeReports(reports []apkSizeReport, deployDir, collisionPolicy string) (jsonPth string, markdownPth string, err error) {
+	content, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return "", "", err
+	}
+	if jsonPth, err = writeDeployFile(deployDir, sizeReportFileName, content, collisionPolicy); err != nil {
+		return "", "", err
+	}
+	if markdownPth, err = writeDeployFile(deployDir, sizeReportMarkdownName, []byte(sizeReportMarkdown(reports)), collisionPolicy); err != nil {
+		return "", "", err
+	}
+	return jsonPth, markdownPth, nil
+}
+
+// reportAPKSizes analyzes the APKs, exports the size reports, compares them with the baseline and checks the thresholds.
+// The report is optional: an APK which can not be analyzed is only an error if a threshold is configured.
+func reportAPKSizes(config Configs, thresholds sizeThresholds, appPth, testPth string) error {
+	reports, err := analyzeAPKSizes(appPth, testPth)
+	if err != nil {
+		if thresholds.enabled() {
+			return fmt.Errorf("Failed to analyze the APK sizes: %v", err)
+		}
+		logger.Warnf("Failed to analyze the APK sizes: %v", err)
+		return nil
+	}
+
+	printSizeReports(reports)
+	reportPath, markdownPath, err := exportSizeReports(reports, config.DeployDir, config.ArtifactNameCollision)
+	if err != nil {
+		return fmt.Errorf("Failed to write the APK size report: %v", err)
+	}
+	// The reports are exported right away, so that they are available when a threshold is exceeded.
+	for _, env := range [][2]string{{sizeReportEnvKey, reportPath}, {sizeReportMarkdownEnvKey, markdownPath}} {
+		if err := tools.ExportEnvironmentWithEnvman(env[0], env[1]); err != nil {
+			return fmt.Errorf("Failed to export environment variable: %s", env[0])
+		}
+		logger.Printf("  Env    [ $%s = $BITRISE_DEPLOY_DIR/%s ]", env[0], filepath.Base(env[1]))
+	}
+
+	if config.SizeBaselinePath != "" {
+		if err := compareWithBaseline(reports, config.SizeBaselinePath, int64(config.SizeDiffThresholdKB)*1024, config.DeployDir, config.ArtifactNameCollision); err != nil {
+			logger.Warnf("Failed to compare the APKs with the baseline: %v", err)
+		}
+	}
+
+	if violations := checkSizeThresholds(reports, thresholds); len(violations) > 0 {
+		return fmt.Errorf("APK size threshold exceeded: %s", strings.Join(violations, "; "))
+	}
+	return nil
+}
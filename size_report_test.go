@@ -0,0 +1,58 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bitrise-steplib/bitrise-step-android-build-for-ui-testing/apk"
+)
+
+func Test_checkSizeThresholds(t *testing.T) {
+	reports := []apkSizeReport{
+		{Name: "app-debug.apk", Role: testBundleRoleApp, SizeReport: apk.SizeReport{Size: 12 * 1024 * 1024, MethodReferences: 40000}},
+		{Name: "app-debug-androidTest.apk", Role: testBundleRoleTest, SizeReport: apk.SizeReport{Size: 2 * 1024 * 1024, MethodReferences: 70000}},
+	}
+
+	tests := []struct {
+		name       string
+		thresholds sizeThresholds
+		want       []string
+	}{
+		{
+			name:       "disabled",
+			thresholds: sizeThresholds{},
+		},
+		{
+			name:       "within the thresholds",
+			thresholds: sizeThresholds{MaxSizeMB: 12, MaxMethodCount: 70000},
+		},
+		{
+			name:       "exceeded",
+			thresholds: sizeThresholds{MaxSizeMB: 10, MaxMethodCount: 65536},
+			want: []string{
+				"the app APK (app-debug.apk) is 12.00 MB, larger than 10 MB",
+				"the test APK (app-debug-androidTest.apk) references 70000 methods, more than 65536",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkSizeThresholds(reports, tt.thresholds); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkSizeThresholds() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_reportAPKSizes_invalidAPK(t *testing.T) {
+	invalid := writeTestFile(t, filepath.Join(t.TempDir(), "app.apk"), "not an APK")
+	config := Configs{DeployDir: t.TempDir()}
+
+	if err := reportAPKSizes(config, sizeThresholds{}, invalid, invalid); err != nil {
+		t.Errorf("reportAPKSizes() error = %v, want only a warning without thresholds", err)
+	}
+	if err := reportAPKSizes(config, sizeThresholds{MaxSizeMB: 10}, invalid, invalid); err == nil {
+		t.Errorf("reportAPKSizes() expected an error with a threshold configured")
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-android/gradle"
+)
+
+const apkSplitPathListEnvKey = "BITRISE_APK_SPLIT_PATH_LIST"
+
+// Split filter types of the output metadata.
+const (
+	abiFilterType     = "ABI"
+	densityFilterType = "DENSITY"
+)
+
+// Known split values, used to recognise the split APKs by their file names (like app-x86_64-debug.apk)
+// when the APKs are not located through the output metadata.
+var (
+	splitABIs      = []string{"armeabi-v7a", "arm64-v8a", "armeabi", "x86_64", "x86", "mips64", "mips"}
+	splitDensities = []string{"ldpi", "mdpi", "tvdpi", "hdpi", "xhdpi", "xxhdpi", "xxxhdpi"}
+)
+
+// apkSplit describes the split filters of an APK, an APK without filters contains all ABIs and densities.
+type apkSplit struct {
+	ABI     string
+	Density string
+}
+
+func (s apkSplit) universal() bool {
+	return s.ABI == "" && s.Density == ""
+}
+
+func (s apkSplit) String() string {
+	if s.universal() {
+		return "universal"
+	}
+	var filters []string
+	for _, filter := range []string{s.ABI, s.Density} {
+		if filter != "" {
+			filters = append(filters, filter)
+		}
+	}
+	return strings.Join(filters, ", ")
+}
+
+func splitFromFilters(filters []outputFilter) apkSplit {
+	var split apkSplit
+	for _, filter := range filters {
+		switch filter.FilterType {
+		case abiFilterType:
+			split.ABI = filter.Value
+		case densityFilterType:
+			split.Density = filter.Value
+		}
+	}
+	return split
+}
+
+// splitFromName recognises the split filters in the name components of an APK, like:
+// app-x86_64-debug.apk, app-hdpiArm64-v8a-debug.apk (density and ABI splits combined).
+func splitFromName(name string) apkSplit {
+	name = strings.ToLower(strings.TrimSuffix(filepath.Base(name), filepath.Ext(name)))
+
+	var split apkSplit
+	for _, abi := range splitABIs {
+		if strings.Contains(name, "-"+abi+"-") || strings.HasSuffix(name, "-"+abi) || containsCombinedSplit(name, abi) {
+			split.ABI = abi
+			break
+		}
+	}
+	for _, density := range splitDensities {
+		if strings.Contains(name, "-"+density) {
+			split.Density = density
+			break
+		}
+	}
+	return split
+}
+
+// containsCombinedSplit checks for an ABI following a density in the same name component, like: hdpiX86_64
+func containsCombinedSplit(name, abi string) bool {
+	for _, density := range splitDensities {
+		if strings.Contains(name, "-"+density+abi+"-") || strings.HasSuffix(name, "-"+density+abi) {
+			return true
+		}
+	}
+	return false
+}
+
+// split returns the split filters of the given APK of the set.
+func (s apkSet) split(artifact gradle.Artifact) apkSplit {
+	if filters, ok := s.Filters[artifact.Path]; ok {
+		return splitFromFilters(filters)
+	}
+	return splitFromName(filepath.Base(artifact.Path))
+}
+
+// selectAppAPK selects the app APK to test when the build produced split APKs: the universal APK if there is one,
+// otherwise the split of the given ABI. The APKs are sorted by name, so that the choice is deterministic.
+func selectAppAPK(set apkSet, abi string) (gradle.Artifact, error) {
+	apks := append([]gradle.Artifact{}, set.App...)
+	sort.Slice(apks, func(i, j int) bool {
+		return apks[i].Name < apks[j].Name
+	})
+
+	if len(apks) == 0 {
+		return gradle.Artifact{}, fmt.Errorf("no app APK found")
+	}
+	if len(apks) == 1 {
+		return apks[0], nil
+	}
+
+	for _, artifact := range apks {
+		if set.split(artifact).universal() {
+			return artifact, nil
+		}
+	}
+
+	if abi == "" {
+		return gradle.Artifact{}, fmt.Errorf("the build produced split APKs without a universal APK (%s), set the ABI to select one", splitList(set, apks))
+	}
+
+	var selected *gradle.Artifact
+	for i, artifact := range apks {
+		split := set.split(artifact)
+		if split.ABI != abi {
+			continue
+		}
+		// An ABI split without a density filter contains all densities.
+		if split.Density == "" {
+			return artifact, nil
+		}
+		if selected == nil {
+			selected = &apks[i]
+		}
+	}
+	if selected == nil {
+		return gradle.Artifact{}, fmt.Errorf("no split APK found for the ABI %s (%s)", abi, splitList(set, apks))
+	}
+	return *selected, nil
+}
+
+func splitList(set apkSet, apks []gradle.Artifact) string {
+	var splits []string
+	for _, artifact := range apks {
+		splits = append(splits, fmt.Sprintf("%s: %s", artifact.Name, set.split(artifact)))
+	}
+	return strings.Join(splits, ", ")
+}
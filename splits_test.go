@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bitrise-io/go-android/gradle"
+)
+
+func Test_splitFromName(t *testing.T) {
+	tests := []struct {
+		name string
+		want apkSplit
+	}{
+		{name: "app-debug.apk", want: apkSplit{}},
+		{name: "app-universal-debug.apk", want: apkSplit{}},
+		{name: "app-x86_64-debug.apk", want: apkSplit{ABI: "x86_64"}},
+		{name: "app-x86-debug.apk", want: apkSplit{ABI: "x86"}},
+		{name: "app-armeabi-v7a-debug.apk", want: apkSplit{ABI: "armeabi-v7a"}},
+		{name: "app-xxhdpi-debug.apk", want: apkSplit{Density: "xxhdpi"}},
+		{name: "app-hdpiArm64-v8a-debug.apk", want: apkSplit{ABI: "arm64-v8a", Density: "hdpi"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitFromName(tt.name); got != tt.want {
+				t.Errorf("splitFromName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_selectAppAPK(t *testing.T) {
+	artifact := func(name string) gradle.Artifact {
+		return gradle.Artifact{Path: "/outputs/" + name, Name: name}
+	}
+
+	metadataSet := apkSet{
+		App: []gradle.Artifact{artifact("app-x86-debug.apk"), artifact("app-x86_64-debug.apk")},
+		Filters: map[string][]outputFilter{
+			"/outputs/app-x86-debug.apk":    {{FilterType: abiFilterType, Value: "x86"}},
+			"/outputs/app-x86_64-debug.apk": {{FilterType: abiFilterType, Value: "x86_64"}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		set     apkSet
+		abi     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "single APK",
+			set:  apkSet{App: []gradle.Artifact{artifact("app-x86_64-debug.apk")}},
+			abi:  "x86",
+			want: "app-x86_64-debug.apk",
+		},
+		{
+			name: "universal APK preferred",
+			set:  apkSet{App: []gradle.Artifact{artifact("app-x86_64-debug.apk"), artifact("app-universal-debug.apk"), artifact("app-x86-debug.apk")}},
+			abi:  "x86",
+			want: "app-universal-debug.apk",
+		},
+		{
+			name: "selected by ABI from output metadata",
+			set:  metadataSet,
+			abi:  "x86_64",
+			want: "app-x86_64-debug.apk",
+		},
+		{
+			name: "ABI split preferred over density and ABI split",
+			set:  apkSet{App: []gradle.Artifact{artifact("app-hdpiX86_64-debug.apk"), artifact("app-x86_64-debug.apk")}},
+			abi:  "x86_64",
+			want: "app-x86_64-debug.apk",
+		},
+		{
+			name:    "no ABI set",
+			set:     metadataSet,
+			wantErr: true,
+		},
+		{
+			name:    "no split for the ABI",
+			set:     metadataSet,
+			abi:     "arm64-v8a",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectAppAPK(tt.set, tt.abi)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("selectAppAPK() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.Name != tt.want {
+				t.Errorf("selectAppAPK() = %v, want %v", got.Name, tt.want)
+			}
+		})
+	}
+}
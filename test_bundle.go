@@ -0,0 +1,187 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/bitrise-io/go-android/gradle"
+)
+
+const (
+	testBundleEnvKey       = "BITRISE_TEST_BUNDLE_PATH"
+	testBundleManifestName = "test-bundle.json"
+)
+
+// Roles of the test bundle entries.
+const (
+	testBundleRoleApp          = "app"
+	testBundleRoleTest         = "test"
+	testBundleRoleOrchestrator = "orchestrator"
+	testBundleRoleTestServices = "test_services"
+)
+
+// testBundleManifest is the test-bundle.json of the test bundle archive, it describes how to run the tests.
+type testBundleManifest struct {
+	Module                string            `json:"module"`
+	Variant               string            `json:"variant"`
+	AppPackage            string            `json:"app_package"`
+	TestPackage           string            `json:"test_package"`
+	InstrumentationRunner string            `json:"instrumentation_runner"`
+	TargetPackage         string            `json:"target_package"`
+	Entries               []testBundleEntry `json:"entries"`
+}
+
+// testBundleEntry is an APK of the test bundle archive.
+type testBundleEntry struct {
+	Name   string `json:"name"`
+	Role   string `json:"role"`
+	SHA256 string `json:"sha256"`
+
+	path string
+}
+
+func newTestBundleEntry(pth, role string) (testBundleEntry, error) {
+	hash, err := fileSHA256(pth)
+	if err != nil {
+		return testBundleEntry{}, err
+	}
+	return testBundleEntry{Name: filepath.Base(pth), Role: role, SHA256: hash, path: pth}, nil
+}
+
+func fileSHA256(pth string) (string, error) {
+	f, err := os.Open(pth)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// writeTestBundle writes the zip archive of the manifest's entries and the test-bundle.json.
+func writeTestBundle(pth string, manifest testBundleManifest) error {
+	f, err := os.Create(pth)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(f)
+	for _, entry := range manifest.Entries {
+		if err := addZipFile(zw, entry.Name, entry.path); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+
+	manifestContent, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	w, err := zw.Create(testBundleManifestName)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	if _, err := w.Write(manifestContent); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func addZipFile(zw *zip.Writer, name, pth string) error {
+	f, err := os.Open(pth)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	// APKs are already compressed archives, they are stored as they are.
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// createTestBundle bundles the exported app, test and test helper APKs into an archive in the deploy dir.
+func createTestBundle(config Configs, info testPackageInfo, appPth, testPth string, testUtilPths map[string]string) (string, error) {
+	manifest := testBundleManifest{
+		Module:                config.Module,
+		Variant:               config.Variant,
+		AppPackage:            info.AppPackage,
+		TestPackage:           info.TestPackage,
+		InstrumentationRunner: info.InstrumentationRunner,
+		TargetPackage:         info.TargetPackage,
+	}
+
+	// Library modules do not have an app APK, their test APK instruments itself.
+	var entries [][2]string
+	if appPth != "" {
+		entries = append(entries, [2]string{appPth, testBundleRoleApp})
+	}
+	entries = append(entries, [2]string{testPth, testBundleRoleTest})
+	if pth, ok := testUtilPths[orchestratorAPKEnvKey]; ok {
+		entries = append(entries, [2]string{pth, testBundleRoleOrchestrator})
+	}
+	if pth, ok := testUtilPths[testServicesAPKEnvKey]; ok {
+		entries = append(entries, [2]string{pth, testBundleRoleTestServices})
+	}
+	for _, e := range entries {
+		entry, err := newTestBundleEntry(e[0], e[1])
+		if err != nil {
+			return "", err
+		}
+		logger.Printf("  %s: %s (sha256: %s)", entry.Role, entry.Name, entry.SHA256)
+		manifest.Entries = append(manifest.Entries, entry)
+	}
+
+	return exportTestBundle(manifest, config.DeployDir, config.ArtifactNameCollision)
+}
+
+// exportTestBundle creates the test bundle archive of the exported APKs and exports it to the deploy dir.
+func exportTestBundle(manifest testBundleManifest, deployDir, collisionPolicy string) (string, error) {
+	tmpDir, err := ioutil.TempDir("", "test-bundle")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+
+	name := fmt.Sprintf("%s-%s-test-bundle.zip", moduleName(manifest.Module), manifest.Variant)
+	pth := filepath.Join(tmpDir, name)
+	if err := writeTestBundle(pth, manifest); err != nil {
+		return "", err
+	}
+
+	pths, err := exportArtifacts([]gradle.Artifact{{Path: pth, Name: name}}, deployDir, collisionPolicy)
+	if err != nil {
+		return "", err
+	}
+	if len(pths) == 0 {
+		return "", fmt.Errorf("failed to export %s", name)
+	}
+	return pths[0], nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_writeTestBundle(t *testing.T) {
+	dir := t.TempDir()
+	appAPK := writeTestFile(t, filepath.Join(dir, "app-debug.apk"), "app")
+	testAPK := writeTestFile(t, filepath.Join(dir, "app-debug-androidTest.apk"), "test")
+
+	appEntry, err := newTestBundleEntry(appAPK, testBundleRoleApp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEntry, err := newTestBundleEntry(testAPK, testBundleRoleTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := testBundleManifest{
+		Module:                "app",
+		Variant:               "debug",
+		AppPackage:            "com.example.app",
+		TestPackage:           "com.example.app.test",
+		InstrumentationRunner: "androidx.test.runner.AndroidJUnitRunner",
+		TargetPackage:         "com.example.app",
+		Entries:               []testBundleEntry{appEntry, testEntry},
+	}
+
+	bundlePth := filepath.Join(dir, "test-bundle.zip")
+	if err := writeTestBundle(bundlePth, manifest); err != nil {
+		t.Fatalf("writeTestBundle() error = %v", err)
+	}
+
+	r, err := zip.OpenReader(bundlePth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	var names []string
+	var got testBundleManifest
+	for _, f := range r.File {
+		names = append(names, f.Name)
+		if f.Name != testBundleManifestName {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.NewDecoder(rc).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		_ = rc.Close()
+	}
+
+	if wantNames := []string{"app-debug.apk", "app-debug-androidTest.apk", testBundleManifestName}; !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("writeTestBundle() entries = %v, want %v", names, wantNames)
+	}
+
+	// The SHA-256 of "app"
+	if want := "a172cedcae47474b615c54d510a5d84a8dea3032e958587430b413538be3f333"; got.Entries[0].SHA256 != want {
+		t.Errorf("writeTestBundle() app SHA-256 = %s, want %s", got.Entries[0].SHA256, want)
+	}
+	got.Entries, manifest.Entries = nil, nil
+	if !reflect.DeepEqual(got, manifest) {
+		t.Errorf("writeTestBundle() manifest = %+v, want %+v", got, manifest)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/bitrise-steplib/bitrise-step-android-build-for-ui-testing/apk"
+)
+
+const (
+	appPackageEnvKey            = "BITRISE_APP_PACKAGE_NAME"
+	testPackageEnvKey           = "BITRISE_TEST_PACKAGE_NAME"
+	instrumentationRunnerEnvKey = "BITRISE_TEST_INSTRUMENTATION_RUNNER"
+	testTargetPackageEnvKey     = "BITRISE_TEST_TARGET_PACKAGE"
+)
+
+// testPackageInfo describes how the test APK instruments the app APK.
+type testPackageInfo struct {
+	AppPackage            string
+	TestPackage           string
+	InstrumentationRunner string
+	TargetPackage         string
+}
+
+func (i testPackageInfo) envs() [][2]string {
+	return [][2]string{
+		{appPackageEnvKey, i.AppPackage},
+		{testPackageEnvKey, i.TestPackage},
+		{instrumentationRunnerEnvKey, i.InstrumentationRunner},
+		{testTargetPackageEnvKey, i.TargetPackage},
+	}
+}
+
+// matchTestPackage checks that the test APK instruments the app APK.
+func matchTestPackage(appManifest, testManifest apk.Manifest) (testPackageInfo, error) {
+	if len(testManifest.Instrumentations) == 0 {
+		return testPackageInfo{}, fmt.Errorf("the test APK (%s) does not declare an instrumentation", testManifest.Package)
+	}
+
+	instrumentation := testManifest.Instrumentations[0]
+	for _, i := range testManifest.Instrumentations {
+		if i.TargetPackage == appManifest.Package {
+			instrumentation = i
+			break
+		}
+	}
+
+	if instrumentation.TargetPackage != appManifest.Package {
+		return testPackageInfo{}, fmt.Errorf("the test APK's target package (%s) does not match the app APK's package (%s)", instrumentation.TargetPackage, appManifest.Package)
+	}
+
+	return testPackageInfo{
+		AppPackage:            appManifest.Package,
+		TestPackage:           testManifest.Package,
+		InstrumentationRunner: instrumentation.Name,
+		TargetPackage:         instrumentation.TargetPackage,
+	}, nil
+}
+
+func printTestPackageInfo(info testPackageInfo) {
+	logger.Printf("  App package:            %s", info.AppPackage)
+	logger.Printf("  Test package:           %s", info.TestPackage)
+	logger.Printf("  Instrumentation runner: %s", info.InstrumentationRunner)
+	logger.Printf("  Target package:         %s", info.TargetPackage)
+}
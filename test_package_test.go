@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bitrise-steplib/bitrise-step-android-build-for-ui-testing/apk"
+)
+
+func Test_matchTestPackage(t *testing.T) {
+	appManifest := apk.Manifest{Package: "com.example.app"}
+
+	tests := []struct {
+		name         string
+		testManifest apk.Manifest
+		want         testPackageInfo
+		wantErr      bool
+	}{
+		{
+			name: "matching target package",
+			testManifest: apk.Manifest{
+				Package:          "com.example.app.test",
+				Instrumentations: []apk.Instrumentation{{Name: "androidx.test.runner.AndroidJUnitRunner", TargetPackage: "com.example.app"}},
+			},
+			want: testPackageInfo{
+				AppPackage:            "com.example.app",
+				TestPackage:           "com.example.app.test",
+				InstrumentationRunner: "androidx.test.runner.AndroidJUnitRunner",
+				TargetPackage:         "com.example.app",
+			},
+		},
+		{
+			name: "instrumentation targeting the app is preferred",
+			testManifest: apk.Manifest{
+				Package: "com.example.app.test",
+				Instrumentations: []apk.Instrumentation{
+					{Name: "com.example.OtherRunner", TargetPackage: "com.example.other"},
+					{Name: "com.example.app.test.Runner", TargetPackage: "com.example.app"},
+				},
+			},
+			want: testPackageInfo{
+				AppPackage:            "com.example.app",
+				TestPackage:           "com.example.app.test",
+				InstrumentationRunner: "com.example.app.test.Runner",
+				TargetPackage:         "com.example.app",
+			},
+		},
+		{
+			name: "target package mismatch",
+			testManifest: apk.Manifest{
+				Package:          "com.example.app.staging.test",
+				Instrumentations: []apk.Instrumentation{{Name: "androidx.test.runner.AndroidJUnitRunner", TargetPackage: "com.example.app.staging"}},
+			},
+			wantErr: true,
+		},
+		{
+			name:         "no instrumentation",
+			testManifest: apk.Manifest{Package: "com.example.app.test"},
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := matchTestPackage(appManifest, tt.testManifest)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("matchTestPackage() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matchTestPackage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"github.com/bitrise-io/go-android/gradle"
+	"github.com/bitrise-steplib/bitrise-step-android-build-for-ui-testing/apk"
+)
+
+// validateArtifacts drops the structurally invalid APKs (truncated, or missing the manifest, the DEX files or
+// the test APK's instrumentation), so that a corrupt artifact is never exported.
+func validateArtifacts(artifacts []gradle.Artifact, testAPKs bool) []gradle.Artifact {
+	var valid []gradle.Artifact
+	for _, artifact := range artifacts {
+		if err := apk.Validate(artifact.Path, testAPKs); err != nil {
+			logger.Warnf("  Reject [ %s: %v ]", artifact.Name, err)
+			continue
+		}
+		valid = append(valid, artifact)
+	}
+	return valid
+}
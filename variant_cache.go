@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/go-android/cache"
+	utilscache "github.com/bitrise-io/go-steputils/cache"
+	"github.com/bitrise-io/go-utils/pathutil"
+)
+
+// cacheLevelTestVariants caches the dependencies (like only_deps), the Gradle build cache,
+// and the compiled outputs of the built app and AndroidTest variants, instead of every build dir (like all).
+const cacheLevelTestVariants = "test_variants"
+
+// moduleVariants are the variants of a module whose compiled outputs are cached.
+type moduleVariants struct {
+	Module   string
+	Variants []string
+}
+
+// testVariantCacheTargets returns the variants built by the step: the app and the AndroidTest variants of the module,
+// or for a benchmark module the variant of the module and of the app module it targets.
+func testVariantCacheTargets(projectLocation, module, variant, moduleType string) ([]moduleVariants, error) {
+	moduleType, err := resolveModuleType(moduleType, projectLocation, module)
+	if err != nil {
+		return nil, err
+	}
+	if moduleType != moduleTypeBenchmark {
+		return []moduleVariants{{Module: module, Variants: []string{variant, variant + testSuffix}}}, nil
+	}
+
+	targetModule, err := benchmarkTargetModule(projectLocation, module)
+	if err != nil {
+		return nil, err
+	}
+	return []moduleVariants{{Module: module, Variants: []string{variant}}, {Module: targetModule, Variants: []string{variant}}}, nil
+}
+
+// variantBuildDirs returns the directories of the module's build dir which hold the compiled outputs of the variants, like:
+//
+//	build/intermediates/javac/freeDebug
+//	build/intermediates/dex/androidTest/freeDebug
+//	build/tmp/kotlin-classes/freeDebugAndroidTest
+//	build/kotlin/compileFreeDebugKotlin
+func variantBuildDirs(moduleDir string, variants []string) ([]string, error) {
+	isVariant := func(name string) bool {
+		for _, variant := range variants {
+			if strings.EqualFold(name, variant) {
+				return true
+			}
+		}
+		return false
+	}
+	isKotlinCompileTask := func(name string) bool {
+		for _, variant := range variants {
+			if strings.EqualFold(name, "compile"+variant+"Kotlin") {
+				return true
+			}
+		}
+		return false
+	}
+
+	var dirs []string
+	buildDir := filepath.Join(moduleDir, "build")
+	for _, parent := range []struct {
+		dir   string
+		match func(string) bool
+	}{
+		{filepath.Join(buildDir, "intermediates"), nil},
+		{filepath.Join(buildDir, "tmp", "kotlin-classes"), isVariant},
+		{filepath.Join(buildDir, "kotlin"), isKotlinCompileTask},
+	} {
+		entries, err := readDirs(parent.dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			pth := filepath.Join(parent.dir, entry)
+			if parent.match != nil {
+				if parent.match(entry) {
+					dirs = append(dirs, pth)
+				}
+				continue
+			}
+
+			// The intermediates are grouped by their kind, the AndroidTest ones are in an androidTest subdirectory by some AGP versions.
+			kindEntries, err := readDirs(pth)
+			if err != nil {
+				return nil, err
+			}
+			for _, kindEntry := range kindEntries {
+				if isVariant(kindEntry) {
+					dirs = append(dirs, filepath.Join(pth, kindEntry))
+				} else if kindEntry == "androidTest" {
+					testEntries, err := readDirs(filepath.Join(pth, kindEntry))
+					if err != nil {
+						return nil, err
+					}
+					for _, testEntry := range testEntries {
+						if isVariant(testEntry) {
+							dirs = append(dirs, filepath.Join(pth, kindEntry, testEntry))
+						}
+					}
+				}
+			}
+		}
+	}
+	return dirs, nil
+}
+
+// readDirs returns the names of the subdirectories, or nothing if the directory does not exist.
+func readDirs(dir string) ([]string, error) {
+	if exists, err := pathutil.IsDirExists(dir); err != nil || !exists {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// projectGradleDirs returns the subdirectories of the project's .gradle dir (the file hashes and the execution history,
+// which the up-to-date checks of the cached outputs depend on), except the configuration cache, which is cached on its own.
+func projectGradleDirs(projectLocation string) ([]string, error) {
+	gradleDir := filepath.Join(projectLocation, ".gradle")
+	entries, err := readDirs(gradleDir)
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, entry := range entries {
+		if entry != "configuration-cache" {
+			dirs = append(dirs, filepath.Join(gradleDir, entry))
+		}
+	}
+	return dirs, nil
+}
+
+// testVariantCacheDirs returns the build dirs of the variants and the project's .gradle dirs.
+func testVariantCacheDirs(projectLocation string, targets []moduleVariants) ([]string, error) {
+	dirs, err := projectGradleDirs(projectLocation)
+	if err != nil {
+		return nil, err
+	}
+	for _, target := range targets {
+		variantDirs, err := variantBuildDirs(moduleDir(projectLocation, target.Module), target.Variants)
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, variantDirs...)
+	}
+	return dirs, nil
+}
+
+// dependencyCacheDirs are the home directories included by the dependency level of AndroidGradleCacheItemCollector.
+var dependencyCacheDirs = []string{"~/.gradle", "~/.kotlin", "~/.m2"}
+
+// testVariantCachePaths extends the dependency cache paths with the dirs of the variants.
+// The generic excludes of the dependency cache (like *.bin, *.lock, *.txt) match any path, they would strip
+// the file hashes and the execution history (fileHashes.bin, executionHistory.bin) and the outputs of the variants.
+// These are scoped to the cached home directories.
+func testVariantCachePaths(includes, excludes, dirs []string) ([]string, []string) {
+	var scoped []string
+	for _, exclude := range excludes {
+		switch {
+		case strings.HasPrefix(exclude, "!"), strings.HasPrefix(exclude, "~"), filepath.IsAbs(exclude):
+			scoped = append(scoped, exclude)
+		case strings.Contains(exclude, "/build/"):
+			// The dependency cache has no build dirs, these would only strip the outputs of the variants.
+		default:
+			for _, dir := range dependencyCacheDirs {
+				scoped = append(scoped, dir+"/"+exclude)
+			}
+		}
+	}
+	return append(append([]string{}, includes...), dirs...), scoped
+}
+
+// collectTestVariantCache collects the dependency cache paths with AndroidGradleCacheItemCollector (the Gradle build cache
+// is part of the cached Gradle home), extended with the build dirs of the variants.
+func collectTestVariantCache(projectLocation string, targets []moduleVariants) error {
+	projectRoot, err := filepath.Abs(projectLocation)
+	if err != nil {
+		return err
+	}
+
+	includes, excludes, err := cache.NewAndroidGradleCacheItemCollector(cmdFactory).Collect(projectRoot, utilscache.LevelDeps)
+	if err != nil {
+		return err
+	}
+
+	dirs, err := testVariantCacheDirs(projectRoot, targets)
+	if err != nil {
+		return fmt.Errorf("failed to collect the build dirs of the variants: %v", err)
+	}
+	for _, dir := range dirs {
+		logger.Printf("  %s", dir)
+	}
+	includes, excludes = testVariantCachePaths(includes, excludes, dirs)
+
+	gradleCache := utilscache.New()
+	gradleCache.IncludePath(includes...)
+	gradleCache.ExcludePath(excludes...)
+	if err := gradleCache.Commit(); err != nil {
+		return fmt.Errorf("failed to commit cache paths: %s", err)
+	}
+	return nil
+}
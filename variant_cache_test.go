@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func Test_variantBuildDirs(t *testing.T) {
+	moduleDir := t.TempDir()
+	buildDir := filepath.Join(moduleDir, "build")
+	for _, dir := range []string{
+		"intermediates/javac/freeDebug",
+		"intermediates/javac/freeDebugAndroidTest",
+		"intermediates/javac/paidDebug",
+		"intermediates/dex/androidTest/freeDebug",
+		"intermediates/dex/androidTest/paidDebug",
+		"tmp/kotlin-classes/freeDebugAndroidTest",
+		"tmp/kotlin-classes/paidRelease",
+		"kotlin/compileFreeDebugKotlin",
+		"kotlin/compilePaidDebugKotlin",
+		"outputs/apk/free/debug",
+	} {
+		if err := os.MkdirAll(filepath.Join(buildDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := variantBuildDirs(moduleDir, []string{"FreeDebug", "freeDebugAndroidTest"})
+	if err != nil {
+		t.Fatalf("variantBuildDirs() error = %v", err)
+	}
+	sort.Strings(got)
+
+	want := []string{
+		filepath.Join(buildDir, "intermediates", "dex", "androidTest", "freeDebug"),
+		filepath.Join(buildDir, "intermediates", "javac", "freeDebug"),
+		filepath.Join(buildDir, "intermediates", "javac", "freeDebugAndroidTest"),
+		filepath.Join(buildDir, "kotlin", "compileFreeDebugKotlin"),
+		filepath.Join(buildDir, "tmp", "kotlin-classes", "freeDebugAndroidTest"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("variantBuildDirs() = %v, want %v", got, want)
+	}
+}
+
+func Test_variantBuildDirs_noBuildDir(t *testing.T) {
+	got, err := variantBuildDirs(t.TempDir(), []string{"debug"})
+	if err != nil {
+		t.Fatalf("variantBuildDirs() error = %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("variantBuildDirs() = %v, want no dirs", got)
+	}
+}
+
+func Test_testVariantCacheTargets(t *testing.T) {
+	project := t.TempDir()
+	writeTestFile(t, filepath.Join(project, "app", "build.gradle"), "apply plugin: 'com.android.application'")
+	writeTestFile(t, filepath.Join(project, "macrobenchmark", "build.gradle.kts"), `plugins { id("com.android.test") }
+android { targetProjectPath = ":app" }`)
+
+	tests := []struct {
+		module string
+		want   []moduleVariants
+	}{
+		{
+			module: "app",
+			want:   []moduleVariants{{Module: "app", Variants: []string{"debug", "debugAndroidTest"}}},
+		},
+		{
+			module: "macrobenchmark",
+			want:   []moduleVariants{{Module: "macrobenchmark", Variants: []string{"debug"}}, {Module: "app", Variants: []string{"debug"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.module, func(t *testing.T) {
+			got, err := testVariantCacheTargets(project, tt.module, "debug", moduleTypeAuto)
+			if err != nil {
+				t.Fatalf("testVariantCacheTargets() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("testVariantCacheTargets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_testVariantCacheDirs(t *testing.T) {
+	project := t.TempDir()
+	for _, dir := range []string{
+		".gradle/8.7/fileHashes",
+		".gradle/buildOutputCleanup",
+		".gradle/configuration-cache",
+		"app/build/intermediates/javac/debug",
+	} {
+		if err := os.MkdirAll(filepath.Join(project, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := testVariantCacheDirs(project, []moduleVariants{{Module: "app", Variants: []string{"debug", "debugAndroidTest"}}})
+	if err != nil {
+		t.Fatalf("testVariantCacheDirs() error = %v", err)
+	}
+
+	want := []string{
+		filepath.Join(project, ".gradle", "8.7"),
+		filepath.Join(project, ".gradle", "buildOutputCleanup"),
+		filepath.Join(project, "app", "build", "intermediates", "javac", "debug"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("testVariantCacheDirs() = %v, want %v", got, want)
+	}
+}
+
+func Test_testVariantCachePaths(t *testing.T) {
+	includes := []string{"/home/.gradle -> /project/gradle.deps", "/home/.m2 -> /project/gradle.deps"}
+	excludes := []string{
+		"!~/.gradle/daemon/*/daemon-*.out.log",
+		"~/.android/build-cache/**",
+		"*.bin",
+		"*/build/*.json",
+		"!*.apk",
+		"/home/.gradle/caches/8.7/fileHashes/fileHashes.lock",
+	}
+	dirs := []string{"/project/.gradle/8.7", "/project/app/build/intermediates/javac/debug"}
+
+	gotIncludes, gotExcludes := testVariantCachePaths(includes, excludes, dirs)
+
+	wantIncludes := []string{
+		"/home/.gradle -> /project/gradle.deps",
+		"/home/.m2 -> /project/gradle.deps",
+		"/project/.gradle/8.7",
+		"/project/app/build/intermediates/javac/debug",
+	}
+	if !reflect.DeepEqual(gotIncludes, wantIncludes) {
+		t.Errorf("testVariantCachePaths() includes = %v, want %v", gotIncludes, wantIncludes)
+	}
+
+	// No exclude may match the file hashes and the execution history of the project, or the outputs of the variants.
+	wantExcludes := []string{
+		"!~/.gradle/daemon/*/daemon-*.out.log",
+		"~/.android/build-cache/**",
+		"~/.gradle/*.bin",
+		"~/.kotlin/*.bin",
+		"~/.m2/*.bin",
+		"!*.apk",
+		"/home/.gradle/caches/8.7/fileHashes/fileHashes.lock",
+	}
+	if !reflect.DeepEqual(gotExcludes, wantExcludes) {
+		t.Errorf("testVariantCachePaths() excludes = %v, want %v", gotExcludes, wantExcludes)
+	}
+}